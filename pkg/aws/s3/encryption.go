@@ -0,0 +1,212 @@
+package s3
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/paraopsde/go-x/pkg/crypto"
+)
+
+// Metadata recording how an object was encrypted on the client.
+const (
+	metaCSE    = "Go-X-Cse"
+	metaCSEKey = "Go-X-Cse-Key"
+
+	cseModeKey      = "chacha"
+	cseModeEnvelope = "envelope"
+)
+
+// ErrNotEncrypted is returned when downloading an object that was not
+// encrypted on the client although client-side encryption is configured.
+var ErrNotEncrypted = errors.New("object not encrypted on the client")
+
+// WithSSES3 makes S3 encrypt stored objects with keys it manages
+// (SSE-S3).
+func WithSSES3() Option {
+	return func(o *options) {
+		o.sse = types.ServerSideEncryptionAes256
+		o.sseKMSKeyID = ""
+	}
+}
+
+// WithSSEKMS makes S3 encrypt stored objects with the KMS key `keyID`
+// (SSE-KMS). An empty `keyID` uses the AWS managed key of the account.
+func WithSSEKMS(keyID string) Option {
+	return func(o *options) {
+		o.sse = types.ServerSideEncryptionAwsKms
+		o.sseKMSKeyID = keyID
+	}
+}
+
+// WithSSEC makes S3 encrypt stored objects with the 256 bit `key`
+// provided by us (SSE-C). S3 does not store the key, so it is needed to
+// read the objects again. It requires HTTPS.
+func WithSSEC(key []byte) Option {
+	return func(o *options) {
+		o.sseCustomerKey = append([]byte{}, key...)
+	}
+}
+
+// WithClientSideKey encrypts object content with `key` before uploading
+// and decrypts it when downloading, so S3 only ever sees sealed content.
+func WithClientSideKey(key *crypto.Key) Option {
+	return func(o *options) {
+		o.cseKey = key
+		o.cseHolder = nil
+	}
+}
+
+// WithClientSideEnvelope encrypts object content with a new data key per
+// object before uploading. The data key is sealed for `holder` and stored
+// in the object metadata. Sealing only needs the public key, so writers
+// may pass a key loaded with `crypto.NewPublicKeyFromHex`; downloading
+// requires the private key of `holder`.
+func WithClientSideEnvelope(holder *crypto.AsymKey) Option {
+	return func(o *options) {
+		o.cseHolder = holder
+		o.cseKey = nil
+	}
+}
+
+func (o *options) validateEncryption() error {
+	if o.sseCustomerKey != nil && len(o.sseCustomerKey) != 32 {
+		return fmt.Errorf("SSE-C key must have 32 bytes, got %d", len(o.sseCustomerKey))
+	}
+	return nil
+}
+
+// serverSide returns the SSE-S3 or SSE-KMS settings for writes.
+func (o *options) serverSide() (types.ServerSideEncryption, *string) {
+	return o.sse, optionalString(o.sseKMSKeyID)
+}
+
+// customerKey returns the SSE-C settings needed for every request
+// touching the object content.
+func (o *options) customerKey() (algorithm, key, keyMD5 *string) {
+	if o.sseCustomerKey == nil {
+		return nil, nil, nil
+	}
+	sum := md5.Sum(o.sseCustomerKey)
+	return aws.String(string(types.ServerSideEncryptionAes256)),
+		aws.String(base64.StdEncoding.EncodeToString(o.sseCustomerKey)),
+		aws.String(base64.StdEncoding.EncodeToString(sum[:]))
+}
+
+func (o *options) clientSide() bool {
+	return o.cseKey != nil || o.cseHolder != nil
+}
+
+// dataKey returns the key to seal a new object with, along with the
+// metadata to store alongside.
+func (o *options) dataKey() (*crypto.Key, map[string]string, error) {
+	if o.cseKey != nil {
+		return o.cseKey, map[string]string{metaCSE: cseModeKey}, nil
+	}
+	key, err := crypto.NewKey()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create data key: %w", err)
+	}
+	sealed, err := o.cseHolder.SealSymKey(key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to seal data key: %w", err)
+	}
+	return key, map[string]string{metaCSE: cseModeEnvelope, metaCSEKey: sealed}, nil
+}
+
+// openingKey returns the key to open an object with the given metadata.
+func (o *options) openingKey(metadata map[string]string) (*crypto.Key, error) {
+	switch mode := metadataValue(metadata, metaCSE); mode {
+	case cseModeKey:
+		if o.cseKey == nil {
+			return nil, errors.New("object is sealed with a key, but none is configured")
+		}
+		return o.cseKey, nil
+	case cseModeEnvelope:
+		if o.cseHolder == nil {
+			return nil, errors.New("object is sealed with a data key, but no key pair is configured")
+		}
+		key, err := o.cseHolder.OpenSymKey(metadataValue(metadata, metaCSEKey))
+		if err != nil {
+			return nil, fmt.Errorf("failed to open data key: %w", err)
+		}
+		return key, nil
+	case "":
+		return nil, ErrNotEncrypted
+	default:
+		return nil, fmt.Errorf("unknown client-side encryption %q", mode)
+	}
+}
+
+// sealStream returns a reader delivering `r` sealed with `key`, ending
+// with an authenticated trailer. Closing it stops the sealing.
+func sealStream(key *crypto.Key, r io.Reader) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		_, err := key.ChachaSealFromReaderWithOptions(context.Background(), r, pw, crypto.SealOptions{})
+		pw.CloseWithError(err)
+	}()
+	return pr
+}
+
+// openStream returns a reader delivering the plain content of `body`
+// sealed with `key`. Reading fails at the end unless the content matches
+// the trailer, so dropped or appended chunks are detected. Closing it
+// closes `body`.
+func openStream(key *crypto.Key, body io.ReadCloser) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		result, err := key.ChachaOpenFromReaderWithOptions(context.Background(), body, pw, crypto.OpenOptions{})
+		if err == nil && !result.Verified {
+			err = fmt.Errorf("%w: sealed content has no trailer", crypto.ErrAuthFailed)
+		}
+		body.Close()
+		pw.CloseWithError(err)
+	}()
+	return &openedStream{PipeReader: pr, body: body}
+}
+
+// openedStream closes the sealed body along with the pipe, so closing
+// it early releases the connection right away instead of on the next
+// write of the opening goroutine.
+type openedStream struct {
+	*io.PipeReader
+	body io.Closer
+}
+
+func (s *openedStream) Close() error {
+	s.PipeReader.Close()
+	return s.body.Close()
+}
+
+// withMetadata returns a copy of `metadata` extended by `extra`.
+func withMetadata(metadata, extra map[string]string) map[string]string {
+	if len(extra) == 0 {
+		return metadata
+	}
+	merged := make(map[string]string, len(metadata)+len(extra))
+	for k, v := range metadata {
+		merged[k] = v
+	}
+	for k, v := range extra {
+		merged[k] = v
+	}
+	return merged
+}
+
+// metadataValue looks up user metadata ignoring case, as S3 returns the
+// keys in lower case.
+func metadataValue(metadata map[string]string, name string) string {
+	for k, v := range metadata {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,145 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/paraopsde/go-x/pkg/crypto"
+)
+
+func TestClientSideEncryption(t *testing.T) {
+	key, err := crypto.NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, opt := range map[string]Option{
+		"key":      WithClientSideKey(key),
+		"envelope": WithClientSideEnvelope(crypto.NewKeyPair()),
+	} {
+		t.Run(name, func(t *testing.T) {
+			fake := newFakeS3()
+			u := NewUploader("bucket", "eu-central-1", WithClient(fake), opt)
+			ctx := context.Background()
+			data := bytes.Repeat([]byte("secret "), 1000)
+
+			if err := u.Upload(ctx, "small", data); err != nil {
+				t.Fatalf("upload failed: %v", err)
+			}
+			if err := u.UploadStream(ctx, "stream", bytes.NewReader(data), nil); err != nil {
+				t.Fatalf("stream upload failed: %v", err)
+			}
+			for _, key := range []string{"small", "stream"} {
+				if bytes.Contains(fake.objects["bucket/"+key], []byte("secret")) {
+					t.Errorf("%s stored in plain", key)
+				}
+				body, err := u.Download(ctx, key)
+				if err != nil {
+					t.Fatalf("download failed: %v", err)
+				}
+				plain, err := io.ReadAll(body)
+				body.Close()
+				if err != nil || !bytes.Equal(plain, data) {
+					t.Errorf("%s: unexpected content, err %v", key, err)
+				}
+			}
+
+			if _, err := u.DownloadRange(ctx, "small", 0, 10); err == nil {
+				t.Errorf("ranged download should fail")
+			}
+			plain := NewUploader("bucket", "eu-central-1", WithClient(fake))
+			if err := plain.Upload(ctx, "plain", data); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := u.Download(ctx, "plain"); !errors.Is(err, ErrNotEncrypted) {
+				t.Errorf("expected ErrNotEncrypted, got %v", err)
+			}
+		})
+	}
+}
+
+func TestClientSideEnvelopeWithPublicKey(t *testing.T) {
+	holder := crypto.NewKeyPair()
+	public, err := crypto.NewPublicKeyFromHex(holder.PublicHex(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := newFakeS3()
+	writer := NewUploader("bucket", "eu-central-1", WithClient(fake), WithClientSideEnvelope(public))
+	reader := NewUploader("bucket", "eu-central-1", WithClient(fake), WithClientSideEnvelope(holder))
+	ctx := context.Background()
+	data := []byte("secret")
+
+	if err := writer.Upload(ctx, "small", data); err != nil {
+		t.Fatalf("upload failed: %v", err)
+	}
+	if _, err := writer.Download(ctx, "small"); !errors.Is(err, crypto.ErrPublicKeyOnly) {
+		t.Errorf("expected ErrPublicKeyOnly, got %v", err)
+	}
+	body, err := reader.Download(ctx, "small")
+	if err != nil {
+		t.Fatalf("download failed: %v", err)
+	}
+	plain, err := io.ReadAll(body)
+	body.Close()
+	if err != nil || !bytes.Equal(plain, data) {
+		t.Errorf("unexpected content, err %v", err)
+	}
+}
+
+func TestClientSideEncryptionDetectsTruncation(t *testing.T) {
+	key, err := crypto.NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := newFakeS3()
+	u := NewUploader("bucket", "eu-central-1", WithClient(fake), WithClientSideKey(key))
+	ctx := context.Background()
+	if err := u.Upload(ctx, "sealed", []byte("secret")); err != nil {
+		t.Fatalf("upload failed: %v", err)
+	}
+	sealed := fake.objects["bucket/sealed"]
+
+	for name, forged := range map[string][]byte{
+		// a lone terminator opens as empty legacy stream
+		"terminator": make([]byte, 8),
+		"no trailer": append(append([]byte{}, sealed[:len(sealed)-8-(8+12+40+16)]...), make([]byte, 8)...),
+	} {
+		fake.objects["bucket/forged"] = forged
+		fake.meta["bucket/forged"] = fake.meta["bucket/sealed"]
+		body, err := u.Download(ctx, "forged")
+		if err != nil {
+			t.Fatalf("%s: download failed: %v", name, err)
+		}
+		_, err = io.ReadAll(body)
+		body.Close()
+		if !errors.Is(err, crypto.ErrAuthFailed) && !errors.Is(err, crypto.ErrTruncated) {
+			t.Errorf("%s: expected authentication error, got %v", name, err)
+		}
+	}
+}
+
+func TestOpenStreamCloseClosesBody(t *testing.T) {
+	key, err := crypto.NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bodyReader, bodyWriter := io.Pipe()
+	opened := openStream(key, bodyReader)
+	if err := opened.Close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+	// nothing was read, so the body must be closed by Close itself
+	if _, err := bodyWriter.Write([]byte("sealed")); !errors.Is(err, io.ErrClosedPipe) {
+		t.Errorf("body not closed, write returned %v", err)
+	}
+}
+
+func TestSSECKeyLength(t *testing.T) {
+	u := NewUploader("bucket", "eu-central-1", WithClient(newFakeS3()), WithSSEC([]byte("short")))
+	if err := u.Upload(context.Background(), "key", []byte("data")); err == nil {
+		t.Errorf("expected error for short SSE-C key")
+	}
+}
@@ -0,0 +1,112 @@
+package s3
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Event is a record of an S3 event notification, e.g. an object created
+// by an upload.
+type Event struct {
+	// Name is the event type without the "s3:" prefix, e.g.
+	// "ObjectCreated:Put" or "ObjectRemoved:Delete".
+	Name      string
+	Time      time.Time
+	Region    string
+	Bucket    string
+	Key       string
+	Size      int64
+	ETag      string
+	VersionID string
+	// Sequencer orders events of the same key; compare it as hex string
+	// after padding to equal length.
+	Sequencer string
+}
+
+// ObjectCreated reports whether the event announces a new object.
+func (e Event) ObjectCreated() bool {
+	return strings.HasPrefix(e.Name, "ObjectCreated:")
+}
+
+// notification is the JSON of S3 event notifications, SNS messages and
+// Lambda SQS events, which all may wrap each other.
+type notification struct {
+	Records []struct {
+		EventSource string    `json:"eventSource"`
+		EventName   string    `json:"eventName"`
+		EventTime   time.Time `json:"eventTime"`
+		AWSRegion   string    `json:"awsRegion"`
+		S3          struct {
+			Bucket struct {
+				Name string `json:"name"`
+			} `json:"bucket"`
+			Object struct {
+				Key       string `json:"key"`
+				Size      int64  `json:"size"`
+				ETag      string `json:"eTag"`
+				VersionID string `json:"versionId"`
+				Sequencer string `json:"sequencer"`
+			} `json:"object"`
+		} `json:"s3"`
+		// Body is set on SQS records passed to Lambda.
+		Body string `json:"body"`
+	} `json:"Records"`
+	// Type and Message are set on notifications delivered via SNS.
+	Type    string `json:"Type"`
+	Message string `json:"Message"`
+	// Event is set on the test event S3 sends when configuring
+	// notifications.
+	Event string `json:"Event"`
+}
+
+// ParseEvents parses the S3 event notifications in `body`, which may be
+// the body of an SQS message, an SNS notification or the payload of a
+// Lambda invoked by S3 or SQS. The test event S3 sends when configuring
+// notifications yields no events.
+func ParseEvents(body []byte) ([]Event, error) {
+	var n notification
+	if err := json.Unmarshal(body, &n); err != nil {
+		return nil, fmt.Errorf("failed to parse S3 event: %w", err)
+	}
+	if n.Event == "s3:TestEvent" {
+		return nil, nil
+	}
+	if n.Type == "Notification" {
+		return ParseEvents([]byte(n.Message))
+	}
+
+	var events []Event
+	for _, r := range n.Records {
+		switch r.EventSource {
+		case "aws:s3":
+			// keys are form encoded, e.g. spaces as "+"
+			key, err := url.QueryUnescape(r.S3.Object.Key)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode key %s: %w", r.S3.Object.Key, err)
+			}
+			events = append(events, Event{
+				Name:      strings.TrimPrefix(r.EventName, "s3:"),
+				Time:      r.EventTime,
+				Region:    r.AWSRegion,
+				Bucket:    r.S3.Bucket.Name,
+				Key:       key,
+				Size:      r.S3.Object.Size,
+				ETag:      r.S3.Object.ETag,
+				VersionID: r.S3.Object.VersionID,
+				Sequencer: r.S3.Object.Sequencer,
+			})
+		case "aws:sqs":
+			nested, err := ParseEvents([]byte(r.Body))
+			if err != nil {
+				return nil, err
+			}
+			events = append(events, nested...)
+		default:
+			return nil, fmt.Errorf("unexpected event source %q", r.EventSource)
+		}
+	}
+	return events, nil
+}
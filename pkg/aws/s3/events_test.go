@@ -0,0 +1,207 @@
+package s3
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+const s3Event = `{"Records":[{"eventVersion":"2.1","eventSource":"aws:s3","awsRegion":"eu-central-1",
+"eventTime":"2024-05-01T12:00:00.000Z","eventName":"ObjectCreated:Put",
+"s3":{"bucket":{"name":"bucket"},"object":{"key":"in/my+report%C3%A4.pdf","size":4,"eTag":"abc","sequencer":"0055"}}}]}`
+
+func TestParseEvents(t *testing.T) {
+	sns, _ := json.Marshal(map[string]string{"Type": "Notification", "Message": s3Event})
+	lambda, _ := json.Marshal(map[string]interface{}{"Records": []map[string]string{
+		{"eventSource": "aws:sqs", "body": s3Event},
+		{"eventSource": "aws:sqs", "body": string(sns)},
+	}})
+
+	for name, tc := range map[string]struct {
+		body string
+		n    int
+	}{
+		"sqs":        {s3Event, 1},
+		"sns":        {string(sns), 1},
+		"lambda sqs": {string(lambda), 2},
+		"test event": {`{"Service":"Amazon S3","Event":"s3:TestEvent","Bucket":"bucket"}`, 0},
+	} {
+		events, err := ParseEvents([]byte(tc.body))
+		if err != nil {
+			t.Fatalf("%s: parse failed: %v", name, err)
+		}
+		if len(events) != tc.n {
+			t.Fatalf("%s: expected %d events, got %d", name, tc.n, len(events))
+		}
+		for _, e := range events {
+			if e.Key != "in/my reportä.pdf" || e.Bucket != "bucket" || e.Size != 4 || !e.ObjectCreated() {
+				t.Errorf("%s: unexpected event: %+v", name, e)
+			}
+			if !e.Time.Equal(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)) {
+				t.Errorf("%s: unexpected time: %v", name, e.Time)
+			}
+		}
+	}
+
+	if _, err := ParseEvents([]byte(`{"Records":[{"eventSource":"aws:kinesis"}]}`)); err == nil {
+		t.Errorf("expected error for unknown event source")
+	}
+}
+
+// fakeQueue delivers its messages once and records deletions.
+type fakeQueue struct {
+	mu       sync.Mutex
+	messages []sqstypes.Message
+	deleted  []string
+	drained  chan struct{}
+}
+
+func (q *fakeQueue) ReceiveMessage(ctx context.Context, in *sqs.ReceiveMessageInput, _ ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error) {
+	q.mu.Lock()
+	n := min(int(in.MaxNumberOfMessages), len(q.messages))
+	messages := q.messages[:n]
+	q.messages = q.messages[n:]
+	q.mu.Unlock()
+	if n == 0 {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return &sqs.ReceiveMessageOutput{Messages: messages}, nil
+}
+
+func (q *fakeQueue) DeleteMessage(ctx context.Context, in *sqs.DeleteMessageInput, _ ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.deleted = append(q.deleted, aws.ToString(in.ReceiptHandle))
+	return &sqs.DeleteMessageOutput{}, nil
+}
+
+func TestWorker(t *testing.T) {
+	fake := newFakeS3()
+	fake.objects["bucket/in/my reportä.pdf"] = []byte("%PDF")
+	u := NewUploader("bucket", "eu-central-1", WithClient(fake))
+
+	queue := &fakeQueue{messages: []sqstypes.Message{
+		{MessageId: aws.String("1"), ReceiptHandle: aws.String("ok"), Body: aws.String(s3Event)},
+		{MessageId: aws.String("2"), ReceiptHandle: aws.String("gone"), Body: aws.String(strings.ReplaceAll(s3Event, "in/my", "in/other"))},
+		{MessageId: aws.String("3"), ReceiptHandle: aws.String("removed"), Body: aws.String(strings.ReplaceAll(s3Event, "ObjectCreated:Put", "ObjectRemoved:Delete"))},
+		{MessageId: aws.String("4"), ReceiptHandle: aws.String("foreign"), Body: aws.String(strings.ReplaceAll(s3Event, `"name":"bucket"`, `"name":"other"`))},
+		{MessageId: aws.String("5"), ReceiptHandle: aws.String("invalid"), Body: aws.String("{")},
+	}}
+
+	var (
+		mu        sync.Mutex
+		processed []string
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	w, err := NewWorker(u, func(ctx context.Context, event Event, body io.Reader) error {
+		data, err := io.ReadAll(body)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		processed = append(processed, string(data))
+		return nil
+	}, &WorkerOptions{Concurrency: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error)
+	go func() { done <- w.Run(ctx, queue, "https://sqs/queue") }()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		queue.mu.Lock()
+		n := len(queue.deleted)
+		queue.mu.Unlock()
+		if n == 3 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+
+	if len(processed) != 1 || processed[0] != "%PDF" {
+		t.Errorf("unexpected objects processed: %v", processed)
+	}
+	deleted := strings.Join(queue.deleted, ",")
+	for _, handle := range []string{"ok", "gone", "removed"} {
+		if !strings.Contains(deleted, handle) {
+			t.Errorf("message %s not deleted: %s", handle, deleted)
+		}
+	}
+	if strings.Contains(deleted, "foreign") || strings.Contains(deleted, "invalid") {
+		t.Errorf("failed messages deleted: %s", deleted)
+	}
+
+	failing, err := NewWorker(u, func(ctx context.Context, event Event, body io.Reader) error {
+		return errors.New("boom")
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := failing.Handle(context.Background(), []byte(s3Event)); err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("expected handler error, got %v", err)
+	}
+}
+
+func TestWorkerReadsEventVersion(t *testing.T) {
+	fake := newFakeS3()
+	fake.objects["bucket/in/my reportä.pdf"] = []byte("%PDF v2")
+	fake.objects["bucket/in/my reportä.pdf?versionId=v1"] = []byte("%PDF v1")
+	u := NewUploader("bucket", "eu-central-1", WithClient(fake))
+
+	var processed string
+	w, err := NewWorker(u, func(ctx context.Context, event Event, body io.Reader) error {
+		data, err := io.ReadAll(body)
+		processed = string(data)
+		return err
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	versioned := strings.Replace(s3Event, `"sequencer"`, `"versionId":"v1","sequencer"`, 1)
+	if err := w.Handle(context.Background(), []byte(versioned)); err != nil {
+		t.Fatalf("handle failed: %v", err)
+	}
+	if processed != "%PDF v1" {
+		t.Errorf("expected the announced version, got %q", processed)
+	}
+
+	// versions deleted since the event are gone, not failures
+	processed = ""
+	deleted := strings.Replace(s3Event, `"sequencer"`, `"versionId":"v0","sequencer"`, 1)
+	if err := w.Handle(context.Background(), []byte(deleted)); err != nil || processed != "" {
+		t.Errorf("expected deleted version to be skipped, got %q, %v", processed, err)
+	}
+}
+
+func TestNewWorkerOptions(t *testing.T) {
+	u := NewUploader("bucket", "eu-central-1", WithClient(newFakeS3()))
+	handler := func(ctx context.Context, event Event, body io.Reader) error { return nil }
+	for _, opts := range []*WorkerOptions{
+		{WaitTime: 21 * time.Second},
+		{VisibilityTimeout: 13 * time.Hour},
+	} {
+		if _, err := NewWorker(u, handler, opts); err == nil {
+			t.Errorf("expected error for %+v", opts)
+		}
+	}
+	w, err := NewWorker(u, handler, &WorkerOptions{WaitTime: 20 * time.Second})
+	if err != nil || w.opts.WaitTime != 20*time.Second || w.opts.Concurrency != 1 {
+		t.Errorf("unexpected worker %+v, err %v", w, err)
+	}
+}
@@ -0,0 +1,170 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/paraopsde/go-x/pkg/aws/s3"
+
+// Metrics are Prometheus metrics of S3 transfers. Create them once per
+// registry and share them between Uploaders.
+type Metrics struct {
+	bytes    *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	errors   *prometheus.CounterVec
+}
+
+// NewMetrics creates the metrics and registers them with `reg`:
+//
+//	s3_transferred_bytes_total{direction}        bytes uploaded and downloaded
+//	s3_request_duration_seconds{operation}       latency of S3 calls including retries
+//	s3_request_errors_total{operation, code}     failed S3 calls by error code
+func NewMetrics(reg prometheus.Registerer) (*Metrics, error) {
+	m := &Metrics{
+		bytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "s3_transferred_bytes_total",
+			Help: "Bytes uploaded to and downloaded from S3.",
+		}, []string{"direction"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "s3_request_duration_seconds",
+			Help:    "Duration of S3 calls including retries.",
+			Buckets: prometheus.ExponentialBuckets(0.01, 2, 14),
+		}, []string{"operation"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "s3_request_errors_total",
+			Help: "Failed S3 calls by error code.",
+		}, []string{"operation", "code"}),
+	}
+	for _, c := range []prometheus.Collector{m.bytes, m.duration, m.errors} {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// WithMetrics records transfers and S3 calls in `metrics`. Only bytes
+// transferred are recorded with an injected client.
+func WithMetrics(metrics *Metrics) Option {
+	return func(o *options) {
+		o.metrics = metrics
+	}
+}
+
+// WithTracerProvider creates spans for S3 calls with `tp` instead of the
+// global provider. Spans are not created with an injected client.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(o *options) {
+		o.tracerProvider = tp
+	}
+}
+
+func (m *Metrics) transferred(direction string, n int64) {
+	if m != nil && n > 0 {
+		m.bytes.WithLabelValues(direction).Add(float64(n))
+	}
+}
+
+func (m *Metrics) observe(operation string, duration time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	m.duration.WithLabelValues(operation).Observe(duration.Seconds())
+	if err != nil {
+		m.errors.WithLabelValues(operation, errorCode(err)).Inc()
+	}
+}
+
+// instrument adds a span and metrics around each S3 call to the client
+// middleware stack.
+func (o *options) instrument(bucket string) func(*middleware.Stack) error {
+	tp := o.tracerProvider
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	tracer := tp.Tracer(instrumentationName)
+
+	return func(stack *middleware.Stack) error {
+		return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("GoXInstrumentation",
+			func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+				operation := awsmiddleware.GetOperationName(ctx)
+				ctx, span := tracer.Start(ctx, "S3."+operation,
+					trace.WithSpanKind(trace.SpanKindClient),
+					trace.WithAttributes(
+						attribute.String("rpc.system", "aws-api"),
+						attribute.String("rpc.service", "S3"),
+						attribute.String("rpc.method", operation),
+						attribute.String("aws.s3.bucket", bucket),
+					))
+				defer span.End()
+
+				start := time.Now()
+				out, metadata, err := next.HandleInitialize(ctx, in)
+				o.metrics.observe(operation, time.Since(start), err)
+				if err != nil {
+					span.RecordError(err)
+					span.SetStatus(codes.Error, errorCode(err))
+				}
+				return out, metadata, err
+			}), middleware.After)
+	}
+}
+
+// errorCode returns the S3 error code of `err` for use as label.
+func errorCode(err error) string {
+	var apiErr smithy.APIError
+	switch {
+	case errors.As(err, &apiErr):
+		return apiErr.ErrorCode()
+	case errors.Is(err, context.Canceled):
+		return "Canceled"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "DeadlineExceeded"
+	}
+	return "Unknown"
+}
+
+// countingReadCloser counts the bytes read from a download.
+type countingReadCloser struct {
+	io.ReadCloser
+	n       int64
+	onClose func(n int64)
+}
+
+func (c *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countingReadCloser) Close() error {
+	if c.onClose != nil {
+		c.onClose(c.n)
+		c.onClose = nil
+	}
+	return c.ReadCloser.Close()
+}
+
+// countingReader counts the bytes read from an upload stream.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,63 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/paraopsde/go-x/pkg/util"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestUploadLogsAndMetrics(t *testing.T) {
+	metrics, err := NewMetrics(prometheus.NewRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	core, logs := observer.New(zap.InfoLevel)
+	ctx := util.CtxWithLog(context.Background(), zap.New(core))
+	u := NewUploader("bucket", "eu-central-1", WithClient(newFakeS3()), WithMetrics(metrics))
+
+	if err := u.Upload(ctx, "report.pdf", []byte("content")); err != nil {
+		t.Fatalf("upload failed: %v", err)
+	}
+	entries := logs.FilterMessage("Uploaded object.").FilterField(zap.String("key", "report.pdf")).All()
+	if len(entries) != 1 || entries[0].ContextMap()["size"] != int64(len("content")) {
+		t.Errorf("unexpected log entries: %v", logs.All())
+	}
+	if got := testutil.ToFloat64(metrics.bytes.WithLabelValues("upload")); got != float64(len("content")) {
+		t.Errorf("unexpected uploaded bytes %v", got)
+	}
+}
+
+func TestRequestMetrics(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?><Error><Code>NoSuchKey</Code><Message>missing</Message></Error>`))
+	}))
+	defer srv.Close()
+
+	metrics, err := NewMetrics(prometheus.NewRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := NewUploader("bucket", "eu-central-1",
+		WithEndpoint(srv.URL), WithPathStyle(), WithStaticCredentials("AKID", "SECRET", ""),
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 1}), WithMetrics(metrics))
+
+	if _, err := u.Download(context.Background(), "missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if got := testutil.ToFloat64(metrics.errors.WithLabelValues("GetObject", "NoSuchKey")); got != 1 {
+		t.Errorf("unexpected error count %v", got)
+	}
+	if got := testutil.CollectAndCount(metrics.duration); got != 1 {
+		t.Errorf("unexpected number of latency series %d", got)
+	}
+}
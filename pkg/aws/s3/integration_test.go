@@ -0,0 +1,270 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/paraopsde/go-x/pkg/aws/s3/s3test"
+	"github.com/paraopsde/go-x/pkg/crypto"
+)
+
+// integrationTarget is the S3 compatible server configured by
+// S3_TEST_ENDPOINT, S3_TEST_BUCKET, S3_TEST_ACCESS_KEY and
+// S3_TEST_SECRET_KEY, e.g. a local MinIO, or an in-process fake server if
+// unset. Tests write below `prefix`.
+type integrationTarget struct {
+	bucket string
+	opts   []Option
+	prefix string
+	// client fetches presigned URLs
+	client *http.Client
+}
+
+func newIntegrationTarget(t *testing.T) *integrationTarget {
+	t.Helper()
+	target := &integrationTarget{prefix: fmt.Sprintf("go-x-test/%d/", time.Now().UnixNano())}
+	if endpoint := os.Getenv("S3_TEST_ENDPOINT"); endpoint != "" {
+		target.bucket, target.client = os.Getenv("S3_TEST_BUCKET"), http.DefaultClient
+		target.opts = []Option{
+			WithEndpoint(endpoint),
+			WithPathStyle(),
+			WithStaticCredentials(os.Getenv("S3_TEST_ACCESS_KEY"), os.Getenv("S3_TEST_SECRET_KEY"), ""),
+		}
+		return target
+	}
+
+	srv := httptest.NewTLSServer(s3test.NewServer("bucket", "AKID"))
+	t.Cleanup(srv.Close)
+	target.bucket, target.client = "bucket", srv.Client()
+	target.opts = []Option{
+		WithEndpoint(srv.URL),
+		WithPathStyle(),
+		WithStaticCredentials("AKID", "SECRET", ""),
+		WithCACertificates(serverCA(srv)),
+	}
+	return target
+}
+
+func (target *integrationTarget) uploader(opts ...Option) *Uploader {
+	return NewUploader(target.bucket, "", append(append([]Option{}, target.opts...), opts...)...)
+}
+
+// serverCA returns the PEM encoded certificate of `srv`.
+func serverCA(srv *httptest.Server) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+}
+
+func TestIntegration(t *testing.T) {
+	ctx := context.Background()
+	target := newIntegrationTarget(t)
+	u, prefix := target.uploader(), target.prefix
+	t.Cleanup(func() {
+		var keys []string
+		for obj, err := range u.List(ctx, prefix) {
+			if err != nil {
+				t.Fatalf("list failed: %v", err)
+			}
+			keys = append(keys, obj.Key)
+		}
+		if err := u.DeleteMany(ctx, keys); err != nil {
+			t.Errorf("cleanup failed: %v", err)
+		}
+	})
+
+	large := make([]byte, MinPartSize+1024)
+	if _, err := rand.Read(large); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("upload and download", func(t *testing.T) {
+		err := u.UploadWithOptions(ctx, prefix+"docs/a b.txt", []byte("hello world"), &UploadOptions{Metadata: map[string]string{"Owner": "test"}})
+		if err != nil {
+			t.Fatalf("upload failed: %v", err)
+		}
+		info, err := u.Head(ctx, prefix+"docs/a b.txt")
+		if err != nil {
+			t.Fatalf("head failed: %v", err)
+		}
+		if info.Size != 11 || info.ContentType != "text/plain; charset=utf-8" || metadataValue(info.Metadata, "Owner") != "test" {
+			t.Errorf("unexpected info: %+v", info)
+		}
+		expectContent(t, u, prefix+"docs/a b.txt", []byte("hello world"))
+
+		body, err := u.DownloadRange(ctx, prefix+"docs/a b.txt", 6, 5)
+		if err != nil {
+			t.Fatalf("range download failed: %v", err)
+		}
+		defer body.Close()
+		if data, _ := io.ReadAll(body); string(data) != "world" {
+			t.Errorf("unexpected range: %q", data)
+		}
+
+		if _, err := u.Head(ctx, prefix+"missing"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected ErrNotFound, got %v", err)
+		}
+	})
+
+	t.Run("conditional write", func(t *testing.T) {
+		opts := &UploadOptions{IfNotExists: true}
+		if err := u.UploadWithOptions(ctx, prefix+"once", []byte("1"), opts); err != nil {
+			t.Fatalf("upload failed: %v", err)
+		}
+		if err := u.UploadWithOptions(ctx, prefix+"once", []byte("2"), opts); !errors.Is(err, ErrExists) {
+			t.Errorf("expected ErrExists, got %v", err)
+		}
+	})
+
+	t.Run("multipart", func(t *testing.T) {
+		if err := u.Upload(ctx, prefix+"large.bin", large); err != nil {
+			t.Fatalf("upload failed: %v", err)
+		}
+		expectContent(t, u, prefix+"large.bin", large)
+
+		err := u.UploadStream(ctx, prefix+"stream.bin", bytes.NewReader(large), &StreamOptions{PartSize: MinPartSize})
+		if err != nil {
+			t.Fatalf("stream upload failed: %v", err)
+		}
+		expectContent(t, u, prefix+"stream.bin", large)
+	})
+
+	t.Run("copy, list and delete", func(t *testing.T) {
+		if err := u.Upload(ctx, prefix+"list/1", []byte("1")); err != nil {
+			t.Fatal(err)
+		}
+		if err := u.Copy(ctx, prefix+"list/1", prefix+"list/2"); err != nil {
+			t.Fatalf("copy failed: %v", err)
+		}
+		var keys []string
+		for obj, err := range u.List(ctx, prefix+"list/") {
+			if err != nil {
+				t.Fatalf("list failed: %v", err)
+			}
+			keys = append(keys, strings.TrimPrefix(obj.Key, prefix))
+		}
+		if strings.Join(keys, ",") != "list/1,list/2" {
+			t.Errorf("unexpected keys: %v", keys)
+		}
+		if err := u.DeleteMany(ctx, []string{prefix + "list/1", prefix + "list/2"}); err != nil {
+			t.Fatalf("delete failed: %v", err)
+		}
+		if _, err := u.Head(ctx, prefix+"list/2"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected deleted object, got %v", err)
+		}
+	})
+
+	t.Run("presign", func(t *testing.T) {
+		if err := u.Upload(ctx, prefix+"shared.txt", []byte("shared")); err != nil {
+			t.Fatal(err)
+		}
+		link, err := u.PresignGet(prefix+"shared.txt", time.Minute)
+		if err != nil {
+			t.Fatalf("presign failed: %v", err)
+		}
+		resp, err := target.client.Get(link)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if data, _ := io.ReadAll(resp.Body); resp.StatusCode != http.StatusOK || string(data) != "shared" {
+			t.Errorf("unexpected response %d: %q", resp.StatusCode, data)
+		}
+	})
+
+	t.Run("client-side encryption", func(t *testing.T) {
+		key, err := crypto.NewKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		sealed := target.uploader(WithClientSideKey(key))
+		if err := sealed.Upload(ctx, prefix+"secret", []byte("secret")); err != nil {
+			t.Fatalf("upload failed: %v", err)
+		}
+		expectContent(t, sealed, prefix+"secret", []byte("secret"))
+		body, err := u.Download(ctx, prefix+"secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer body.Close()
+		if data, _ := io.ReadAll(body); bytes.Contains(data, []byte("secret")) {
+			t.Errorf("content stored in plain text")
+		}
+	})
+}
+
+func expectContent(t *testing.T, u *Uploader, key string, expected []byte) {
+	t.Helper()
+	body, err := u.Download(context.Background(), key)
+	if err != nil {
+		t.Fatalf("download of %s failed: %v", key, err)
+	}
+	defer body.Close()
+	data, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatalf("read of %s failed: %v", key, err)
+	}
+	if !bytes.Equal(data, expected) {
+		t.Errorf("unexpected content of %s: %d bytes, expected %d", key, len(data), len(expected))
+	}
+}
+
+func TestSSECMultipart(t *testing.T) {
+	ctx := context.Background()
+	srv := httptest.NewTLSServer(s3test.NewServer("bucket", "AKID"))
+	defer srv.Close()
+	opts := []Option{WithEndpoint(srv.URL), WithPathStyle(), WithStaticCredentials("AKID", "SECRET", ""), WithCACertificates(serverCA(srv))}
+	u := NewUploader("bucket", "", append(opts, WithSSEC(bytes.Repeat([]byte("k"), 32)))...)
+
+	large := make([]byte, MinPartSize+1024)
+	if _, err := rand.Read(large); err != nil {
+		t.Fatal(err)
+	}
+	if err := u.Upload(ctx, "large.bin", large); err != nil {
+		t.Fatalf("upload failed: %v", err)
+	}
+	expectContent(t, u, "large.bin", large)
+	err := u.UploadStream(ctx, "stream.bin", bytes.NewReader(large), &StreamOptions{PartSize: MinPartSize})
+	if err != nil {
+		t.Fatalf("stream upload failed: %v", err)
+	}
+	expectContent(t, u, "stream.bin", large)
+
+	if _, err := NewUploader("bucket", "", opts...).Download(ctx, "stream.bin"); err == nil {
+		t.Errorf("download without the SSE-C key should fail")
+	}
+}
+
+func TestEndpointOptions(t *testing.T) {
+	ctx := context.Background()
+	srv := httptest.NewTLSServer(s3test.NewServer("bucket", "AKID"))
+	defer srv.Close()
+
+	for name, tc := range map[string]struct {
+		opts []Option
+		err  string
+	}{
+		"untrusted certificate": {[]Option{WithStaticCredentials("AKID", "SECRET", "")}, "certificate"},
+		"invalid CA":            {[]Option{WithStaticCredentials("AKID", "SECRET", ""), WithCACertificates([]byte("junk"))}, "no certificates"},
+		"wrong credentials":     {[]Option{WithStaticCredentials("OTHER", "SECRET", ""), WithCACertificates(serverCA(srv))}, "InvalidAccessKeyId"},
+		"tls config":            {[]Option{WithStaticCredentials("AKID", "SECRET", ""), WithTLSConfig(srv.Client().Transport.(*http.Transport).TLSClientConfig)}, ""},
+	} {
+		opts := append([]Option{WithEndpoint(srv.URL), WithPathStyle(), WithRetryPolicy(RetryPolicy{MaxAttempts: 1})}, tc.opts...)
+		err := NewUploader("bucket", "", opts...).Upload(ctx, "key", []byte("data"))
+		if tc.err == "" && err != nil {
+			t.Errorf("%s: upload failed: %v", name, err)
+		}
+		if tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)) {
+			t.Errorf("%s: expected error containing %q, got %v", name, tc.err, err)
+		}
+	}
+}
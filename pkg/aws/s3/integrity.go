@@ -0,0 +1,172 @@
+package s3
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+var (
+	// ErrExists is returned by uploads with `UploadOptions.IfNotExists`
+	// set when an object is already stored at the key.
+	ErrExists = errors.New("object already exists")
+	// ErrChecksumMismatch is returned when S3 reports a checksum of an
+	// upload that differs from the one of the content sent.
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+)
+
+// RetryPolicy configures how failed S3 requests are retried. Requests
+// are retried with exponential backoff and jitter on throttling, timeouts,
+// server errors and content digests S3 rejected.
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts including the first one. 1
+	// disables retries; 0 keeps the SDK default of 3.
+	MaxAttempts int
+	// MaxBackoff caps the delay between attempts; 0 keeps the SDK
+	// default of 20s.
+	MaxBackoff time.Duration
+}
+
+// WithRetryPolicy replaces the default retry policy of the client.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(o *options) {
+		o.retry = policy
+	}
+}
+
+func (o *options) retryer() aws.Retryer {
+	return retry.NewStandard(func(so *retry.StandardOptions) {
+		if o.retry.MaxAttempts > 0 {
+			so.MaxAttempts = o.retry.MaxAttempts
+		}
+		if o.retry.MaxBackoff > 0 {
+			so.MaxBackoff = o.retry.MaxBackoff
+		}
+		// S3 rejects content damaged in transit with BadDigest
+		so.Retryables = append(so.Retryables, retry.RetryableErrorCode{
+			Codes: map[string]struct{}{"BadDigest": {}},
+		})
+	})
+}
+
+// etagIsMD5 reports whether S3 returns the MD5 of the content as ETag of
+// single part uploads, which it does not for SSE-KMS and SSE-C.
+func (o *options) etagIsMD5() bool {
+	return o.sse != types.ServerSideEncryptionAwsKms && o.sseCustomerKey == nil
+}
+
+// contentSums holds the checksums of uploaded content.
+type contentSums struct {
+	md5    [md5.Size]byte
+	sha256 [sha256.Size]byte
+}
+
+func newContentSums(data []byte) contentSums {
+	return contentSums{md5: md5.Sum(data), sha256: sha256.Sum256(data)}
+}
+
+// contentMD5 returns the value of the Content-MD5 header.
+func (s contentSums) contentMD5() *string {
+	return aws.String(base64.StdEncoding.EncodeToString(s.md5[:]))
+}
+
+// checksumSHA256 returns the value of the x-amz-checksum-sha256 header.
+func (s contentSums) checksumSHA256() *string {
+	return aws.String(base64.StdEncoding.EncodeToString(s.sha256[:]))
+}
+
+func (s contentSums) md5Hex() string {
+	return hex.EncodeToString(s.md5[:])
+}
+
+// verify compares the checksums S3 returned for the content. Pass a nil
+// `etag` if it is not the MD5 of the content.
+func (s contentSums) verify(etag, checksumSHA256 *string) error {
+	if etag != nil && strings.Trim(*etag, `"`) != s.md5Hex() {
+		return fmt.Errorf("%w: etag %s, md5 %s", ErrChecksumMismatch, *etag, s.md5Hex())
+	}
+	if checksumSHA256 != nil && *checksumSHA256 != *s.checksumSHA256() {
+		return fmt.Errorf("%w: sha256 %s, expected %s", ErrChecksumMismatch, *checksumSHA256, *s.checksumSHA256())
+	}
+	return nil
+}
+
+// multipartETag returns the ETag S3 computes for a multipart upload: the
+// MD5 of the concatenated part MD5s followed by the number of parts.
+func multipartETag(parts []CompletedPart) (string, error) {
+	h := md5.New()
+	for _, part := range parts {
+		sum, err := hex.DecodeString(part.MD5)
+		if err != nil {
+			return "", fmt.Errorf("invalid md5 of part %d: %w", part.Number, err)
+		}
+		h.Write(sum)
+	}
+	return fmt.Sprintf("%x-%d", h.Sum(nil), len(parts)), nil
+}
+
+// verifyParts compares the checksums S3 returned for the parts of
+// `data`, uploaded in parts of `partSize`, and the ETag of the object.
+// Pass a nil `etag` if it is not derived from the MD5 of the content.
+func verifyParts(data []byte, partSize int64, parts []types.CompletedPart, etag *string) error {
+	expected := (int64(len(data)) + partSize - 1) / partSize
+	if int64(len(parts)) != expected {
+		return fmt.Errorf("%w: %d parts, expected %d", ErrChecksumMismatch, len(parts), expected)
+	}
+	sorted := make([]CompletedPart, len(parts))
+	for _, part := range parts {
+		number := int64(aws.ToInt32(part.PartNumber))
+		if number < 1 || number > expected {
+			return fmt.Errorf("%w: unexpected part %d", ErrChecksumMismatch, number)
+		}
+		start := (number - 1) * partSize
+		sums := newContentSums(data[start:min(start+partSize, int64(len(data)))])
+		partETag := part.ETag
+		if etag == nil {
+			partETag = nil
+		}
+		if err := sums.verify(partETag, part.ChecksumSHA256); err != nil {
+			return fmt.Errorf("part %d: %w", number, err)
+		}
+		sorted[number-1] = CompletedPart{Number: number, MD5: sums.md5Hex()}
+	}
+	if etag == nil {
+		return nil
+	}
+	objectETag, err := multipartETag(sorted)
+	if err != nil {
+		return err
+	}
+	if strings.Trim(*etag, `"`) != objectETag {
+		return fmt.Errorf("%w: etag %s, expected %s", ErrChecksumMismatch, *etag, objectETag)
+	}
+	return nil
+}
+
+// preconditionFailed maps the error of a conditional write to
+// `ErrExists`.
+func preconditionFailed(err error) error {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && apiErr.ErrorCode() == "PreconditionFailed" {
+		return fmt.Errorf("%w: %w", ErrExists, err)
+	}
+	return err
+}
+
+// ifNoneMatch returns the If-None-Match header of conditional writes.
+func ifNoneMatch(ifNotExists bool) *string {
+	if !ifNotExists {
+		return nil
+	}
+	return aws.String("*")
+}
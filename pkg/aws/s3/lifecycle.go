@@ -0,0 +1,132 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// LifecycleRule expires or transitions the objects below a prefix. Zero
+// values leave the respective action out.
+type LifecycleRule struct {
+	// ID identifies the rule within the bucket configuration.
+	ID     string
+	Prefix string
+	// ExpireAfterDays expires current versions; in versioned buckets a
+	// delete marker is added instead.
+	ExpireAfterDays int32
+	// NoncurrentExpireAfterDays permanently deletes versions that have
+	// been noncurrent for this long.
+	NoncurrentExpireAfterDays int32
+	// AbortUploadsAfterDays aborts incomplete multipart uploads.
+	AbortUploadsAfterDays int32
+	// TransitionAfterDays moves current versions to TransitionStorageClass,
+	// e.g. "GLACIER_IR".
+	TransitionAfterDays    int32
+	TransitionStorageClass string
+}
+
+// LifecycleRules returns the lifecycle rules of the bucket, including
+// those not created by `SetLifecycleRule`.
+func (u *Uploader) LifecycleRules(ctx context.Context) ([]types.LifecycleRule, error) {
+	s3Client, err := u.s3Client()
+	if err != nil {
+		return nil, err
+	}
+	out, err := s3Client.GetBucketLifecycleConfiguration(ctx, &s3.GetBucketLifecycleConfigurationInput{
+		Bucket: aws.String(u.bucket),
+	})
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && apiErr.ErrorCode() == "NoSuchLifecycleConfiguration" {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get lifecycle of %s: %w", u.bucket, err)
+	}
+	return out.Rules, nil
+}
+
+// SetLifecycleRule adds `rule` to the lifecycle configuration of the
+// bucket, replacing a rule with the same ID. Other rules are kept.
+func (u *Uploader) SetLifecycleRule(ctx context.Context, rule LifecycleRule) error {
+	if rule.ID == "" {
+		return errors.New("lifecycle rule needs an id")
+	}
+	if (rule.TransitionAfterDays > 0) != (rule.TransitionStorageClass != "") {
+		return fmt.Errorf("lifecycle rule %s needs both transition days and storage class", rule.ID)
+	}
+	rules, err := u.LifecycleRules(ctx)
+	if err != nil {
+		return err
+	}
+	return u.putLifecycleRules(ctx, append(withoutRule(rules, rule.ID), rule.toSDK()))
+}
+
+// RemoveLifecycleRule removes the rule with `id` from the lifecycle
+// configuration of the bucket.
+func (u *Uploader) RemoveLifecycleRule(ctx context.Context, id string) error {
+	rules, err := u.LifecycleRules(ctx)
+	if err != nil {
+		return err
+	}
+	return u.putLifecycleRules(ctx, withoutRule(rules, id))
+}
+
+func (u *Uploader) putLifecycleRules(ctx context.Context, rules []types.LifecycleRule) error {
+	s3Client, err := u.s3Client()
+	if err != nil {
+		return err
+	}
+	// a configuration without rules is invalid
+	if len(rules) == 0 {
+		_, err = s3Client.DeleteBucketLifecycle(ctx, &s3.DeleteBucketLifecycleInput{Bucket: aws.String(u.bucket)})
+	} else {
+		_, err = s3Client.PutBucketLifecycleConfiguration(ctx, &s3.PutBucketLifecycleConfigurationInput{
+			Bucket:                 aws.String(u.bucket),
+			LifecycleConfiguration: &types.BucketLifecycleConfiguration{Rules: rules},
+		})
+	}
+	if err != nil {
+		return fmt.Errorf("failed to put lifecycle of %s: %w", u.bucket, err)
+	}
+	return nil
+}
+
+func (rule LifecycleRule) toSDK() types.LifecycleRule {
+	r := types.LifecycleRule{
+		ID:     aws.String(rule.ID),
+		Status: types.ExpirationStatusEnabled,
+		Filter: &types.LifecycleRuleFilter{Prefix: aws.String(rule.Prefix)},
+	}
+	if rule.ExpireAfterDays > 0 {
+		r.Expiration = &types.LifecycleExpiration{Days: aws.Int32(rule.ExpireAfterDays)}
+	}
+	if rule.NoncurrentExpireAfterDays > 0 {
+		r.NoncurrentVersionExpiration = &types.NoncurrentVersionExpiration{NoncurrentDays: aws.Int32(rule.NoncurrentExpireAfterDays)}
+	}
+	if rule.AbortUploadsAfterDays > 0 {
+		r.AbortIncompleteMultipartUpload = &types.AbortIncompleteMultipartUpload{DaysAfterInitiation: aws.Int32(rule.AbortUploadsAfterDays)}
+	}
+	if rule.TransitionAfterDays > 0 {
+		r.Transitions = []types.Transition{{
+			Days:         aws.Int32(rule.TransitionAfterDays),
+			StorageClass: types.TransitionStorageClass(rule.TransitionStorageClass),
+		}}
+	}
+	return r
+}
+
+func withoutRule(rules []types.LifecycleRule, id string) []types.LifecycleRule {
+	kept := make([]types.LifecycleRule, 0, len(rules))
+	for _, r := range rules {
+		if aws.ToString(r.ID) != id {
+			kept = append(kept, r)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,407 @@
+package s3
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/paraopsde/go-x/pkg/util"
+)
+
+const (
+	// DefaultPartSize is the part size of multipart uploads unless
+	// configured otherwise.
+	DefaultPartSize int64 = 16 * 1024 * 1024
+	// MinPartSize is the smallest part size S3 accepts (except for the
+	// last part).
+	MinPartSize int64 = 5 * 1024 * 1024
+	// DefaultConcurrency is the number of parts uploaded in parallel
+	// unless configured otherwise.
+	DefaultConcurrency = 4
+
+	maxParts = 10000
+	// sniffLen is the number of bytes http.DetectContentType considers.
+	sniffLen = 512
+)
+
+// StreamOptions configure `UploadStream`.
+type StreamOptions struct {
+	// UploadOptions set the properties of the uploaded object. The
+	// content type is detected from the first bytes of the stream if
+	// it cannot be derived from the key.
+	UploadOptions
+
+	// PartSize is the size of the parts the stream is split into. It
+	// limits the size of the stream to 10000 parts. Memory use is about
+	// (Concurrency+1) * PartSize.
+	PartSize int64
+	// Concurrency is the number of parts uploaded in parallel.
+	Concurrency int
+	// Resumable keeps the uploaded parts of a failed upload instead of
+	// aborting it. The error returned then is a *ResumableError holding
+	// the state to pass as `Resume` to continue the upload.
+	Resumable bool
+	// Resume continues a previous upload. The reader must deliver the
+	// same content from the start again; parts uploaded before are
+	// verified and skipped. A stream ending before parts uploaded
+	// before fails.
+	Resume *MultipartState
+}
+
+// MultipartState records the progress of a multipart upload, so it can
+// be resumed. It can be marshalled to JSON for persistence.
+type MultipartState struct {
+	Key      string          `json:"key"`
+	UploadID string          `json:"uploadId"`
+	PartSize int64           `json:"partSize"`
+	Parts    []CompletedPart `json:"parts"`
+}
+
+// CompletedPart is a successfully uploaded part of a multipart upload.
+type CompletedPart struct {
+	Number int64  `json:"number"`
+	Size   int64  `json:"size"`
+	ETag   string `json:"etag"`
+	// MD5 is the hex encoded MD5 of the part content, used to verify
+	// the stream did not change when resuming.
+	MD5 string `json:"md5"`
+	// SHA256 is the base64 encoded SHA-256 of the part content as sent
+	// to S3.
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// ResumableError is returned by `UploadStream` for failed uploads with
+// `StreamOptions.Resumable` set.
+type ResumableError struct {
+	State *MultipartState
+	Err   error
+}
+
+func (e *ResumableError) Error() string {
+	return fmt.Sprintf("resumable upload %s failed after %d parts: %v", e.State.UploadID, len(e.State.Parts), e.Err)
+}
+
+func (e *ResumableError) Unwrap() error {
+	return e.Err
+}
+
+// UploadStream uploads everything read from `r` to `key` using an S3
+// multipart upload, so the content never has to be held in memory as a
+// whole. Failed uploads are aborted unless `opts.Resumable` is set,
+// which is not supported with client-side encryption. `opts` may be nil.
+// The outcome is logged to the logger of `ctx`.
+//
+// To upload sealed content, connect it with a pipe:
+//
+//	pr, pw := io.Pipe()
+//	go func() {
+//		_, err := key.ChachaSealFromReaderWithOptions(ctx, file, pw, crypto.SealOptions{})
+//		pw.CloseWithError(err)
+//	}()
+//	err := uploader.UploadStream(ctx, "archive.sealed", pr, nil)
+func (u *Uploader) UploadStream(ctx context.Context, key string, r io.Reader, opts *StreamOptions) error {
+	log, ctx := util.CtxLogOrInjectNew(ctx)
+	start := time.Now()
+	counted := &countingReader{r: r}
+	err := u.uploadStream(ctx, key, counted, opts)
+	u.logUpload(log, key, counted.n, start, err)
+	return err
+}
+
+func (u *Uploader) uploadStream(ctx context.Context, key string, r io.Reader, opts *StreamOptions) error {
+	if opts == nil {
+		opts = &StreamOptions{}
+	}
+	s3Client, err := u.s3Client()
+	if err != nil {
+		return err
+	}
+
+	// peek for content type detection
+	buffered := bufio.NewReaderSize(r, sniffLen)
+	head, err := buffered.Peek(sniffLen)
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("failed to read stream: %w", err)
+	}
+	r = buffered
+
+	var metadata map[string]string
+	if u.opts.clientSide() {
+		// sealing is randomized, so parts cannot be verified on resume
+		if opts.Resumable || opts.Resume != nil {
+			return fmt.Errorf("resumable uploads are not supported with client-side encryption")
+		}
+		dataKey, extra, err := u.opts.dataKey()
+		if err != nil {
+			return err
+		}
+		sealed := sealStream(dataKey, r)
+		defer sealed.Close()
+		r = sealed
+		metadata = extra
+	}
+
+	state, err := u.startMultipart(ctx, key, head, metadata, opts)
+	if err != nil {
+		return err
+	}
+
+	err = u.uploadParts(ctx, state, r, opts)
+	if err == nil {
+		err = u.completeMultipart(ctx, state, opts)
+	}
+	if err == nil {
+		return nil
+	}
+
+	if opts.Resumable {
+		return &ResumableError{State: state, Err: err}
+	}
+	// abort with a fresh context, ctx may be the reason for the failure
+	_, abortErr := s3Client.AbortMultipartUpload(context.Background(), &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(u.bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(state.UploadID),
+	})
+	if abortErr != nil {
+		return fmt.Errorf("%w (failed to abort upload %s: %v)", err, state.UploadID, abortErr)
+	}
+	return err
+}
+
+func (u *Uploader) startMultipart(ctx context.Context, key string, head []byte, metadata map[string]string, opts *StreamOptions) (*MultipartState, error) {
+	if opts.Resume != nil {
+		if opts.Resume.Key != key {
+			return nil, fmt.Errorf("cannot resume upload of %s as %s", opts.Resume.Key, key)
+		}
+		state := *opts.Resume
+		state.Parts = append([]CompletedPart{}, opts.Resume.Parts...)
+		return &state, nil
+	}
+
+	partSize := opts.PartSize
+	if partSize == 0 {
+		partSize = DefaultPartSize
+	}
+	if partSize < MinPartSize {
+		return nil, fmt.Errorf("part size %d below minimum of %d", partSize, MinPartSize)
+	}
+
+	s3Client, err := u.s3Client()
+	if err != nil {
+		return nil, err
+	}
+	in := &s3.CreateMultipartUploadInput{
+		Bucket:             aws.String(u.bucket),
+		Key:                aws.String(key),
+		ContentType:        aws.String(detectContentType(key, opts.ContentType, head)),
+		ContentDisposition: optionalString(opts.ContentDisposition),
+		CacheControl:       optionalString(opts.CacheControl),
+		Metadata:           withMetadata(opts.Metadata, metadata),
+		Tagging:            optionalString(encodeTags(opts.Tags)),
+		StorageClass:       types.StorageClass(opts.StorageClass),
+		ACL:                types.ObjectCannedACL(opts.ACL),
+		ObjectLockMode:     types.ObjectLockMode(opts.ObjectLockMode),
+		ChecksumAlgorithm:  types.ChecksumAlgorithmSha256,
+	}
+	if !opts.ObjectLockRetainUntil.IsZero() {
+		in.ObjectLockRetainUntilDate = aws.Time(opts.ObjectLockRetainUntil)
+	}
+	in.ServerSideEncryption, in.SSEKMSKeyId = u.opts.serverSide()
+	in.SSECustomerAlgorithm, in.SSECustomerKey, in.SSECustomerKeyMD5 = u.opts.customerKey()
+	out, err := s3Client.CreateMultipartUpload(ctx, in)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create multipart upload: %w", err)
+	}
+	return &MultipartState{
+		Key:      key,
+		UploadID: aws.ToString(out.UploadId),
+		PartSize: partSize,
+	}, nil
+}
+
+func (u *Uploader) uploadParts(ctx context.Context, state *MultipartState, r io.Reader, opts *StreamOptions) error {
+	s3Client, err := u.s3Client()
+	if err != nil {
+		return err
+	}
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultConcurrency
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		sem      = make(chan struct{}, concurrency)
+		free     = make(chan []byte, concurrency)
+		resumed  = map[int64]CompletedPart{}
+		last     int64
+	)
+	fail := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if firstErr == nil {
+			firstErr = err
+			cancel()
+		}
+	}
+	recycle := func(buf []byte) {
+		select {
+		case free <- buf:
+		default:
+		}
+	}
+	for _, part := range state.Parts {
+		resumed[part.Number] = part
+	}
+
+	for number := int64(1); ; number++ {
+		var buf []byte
+		select {
+		case buf = <-free:
+		default:
+			buf = make([]byte, state.PartSize)
+		}
+		n, err := io.ReadFull(r, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			fail(fmt.Errorf("failed to read part %d: %w", number, err))
+			break
+		}
+		if n == 0 && number > 1 {
+			break
+		}
+		if number > maxParts {
+			fail(fmt.Errorf("stream exceeds %d parts of %d bytes", maxParts, state.PartSize))
+			break
+		}
+		eof := n < len(buf)
+		last = number
+
+		sums := newContentSums(buf[:n])
+		if part, ok := resumed[number]; ok {
+			if part.Size != int64(n) || part.MD5 != sums.md5Hex() {
+				fail(fmt.Errorf("part %d differs from the one uploaded before", number))
+				break
+			}
+			recycle(buf)
+		} else {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+			}
+			if ctx.Err() != nil {
+				break
+			}
+			wg.Add(1)
+			go func(number int64, buf []byte, n int) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				in := &s3.UploadPartInput{
+					Bucket:         aws.String(u.bucket),
+					Key:            aws.String(state.Key),
+					UploadId:       aws.String(state.UploadID),
+					PartNumber:     aws.Int32(int32(number)),
+					Body:           bytes.NewReader(buf[:n]),
+					ContentLength:  aws.Int64(int64(n)),
+					ContentMD5:     sums.contentMD5(),
+					ChecksumSHA256: sums.checksumSHA256(),
+				}
+				in.SSECustomerAlgorithm, in.SSECustomerKey, in.SSECustomerKeyMD5 = u.opts.customerKey()
+				out, err := s3Client.UploadPart(ctx, in)
+				if err != nil {
+					fail(fmt.Errorf("failed to upload part %d: %w", number, err))
+					return
+				}
+				etag := out.ETag
+				if !u.opts.etagIsMD5() {
+					etag = nil
+				}
+				if err := sums.verify(etag, out.ChecksumSHA256); err != nil {
+					fail(fmt.Errorf("failed to upload part %d: %w", number, err))
+					return
+				}
+				mu.Lock()
+				state.Parts = append(state.Parts, CompletedPart{
+					Number: number,
+					Size:   int64(n),
+					ETag:   aws.ToString(out.ETag),
+					MD5:    sums.md5Hex(),
+					SHA256: *sums.checksumSHA256(),
+				})
+				mu.Unlock()
+				recycle(buf)
+			}(number, buf, n)
+		}
+		if eof {
+			break
+		}
+	}
+	wg.Wait()
+
+	// parts uploaded before past the end of a shorter stream would be
+	// completed into the object
+	for _, part := range resumed {
+		if firstErr == nil && part.Number > last {
+			fail(fmt.Errorf("stream ended with part %d, but part %d was uploaded before", last, part.Number))
+		}
+	}
+
+	sort.Slice(state.Parts, func(i, j int) bool {
+		return state.Parts[i].Number < state.Parts[j].Number
+	})
+	if firstErr == nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return firstErr
+}
+
+func (u *Uploader) completeMultipart(ctx context.Context, state *MultipartState, opts *StreamOptions) error {
+	s3Client, err := u.s3Client()
+	if err != nil {
+		return err
+	}
+	parts := make([]types.CompletedPart, 0, len(state.Parts))
+	for _, part := range state.Parts {
+		parts = append(parts, types.CompletedPart{
+			ETag:           aws.String(part.ETag),
+			PartNumber:     aws.Int32(int32(part.Number)),
+			ChecksumSHA256: optionalString(part.SHA256),
+		})
+	}
+	in := &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(u.bucket),
+		Key:             aws.String(state.Key),
+		UploadId:        aws.String(state.UploadID),
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+		IfNoneMatch:     ifNoneMatch(opts.IfNotExists),
+	}
+	in.SSECustomerAlgorithm, in.SSECustomerKey, in.SSECustomerKeyMD5 = u.opts.customerKey()
+	out, err := s3Client.CompleteMultipartUpload(ctx, in)
+	if err != nil {
+		return fmt.Errorf("failed to complete multipart upload: %w", preconditionFailed(err))
+	}
+	if u.opts.etagIsMD5() {
+		expected, err := multipartETag(state.Parts)
+		if err != nil {
+			return err
+		}
+		if etag := strings.Trim(aws.ToString(out.ETag), `"`); etag != expected {
+			return fmt.Errorf("%w: etag %s of multipart upload, expected %s", ErrChecksumMismatch, etag, expected)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestUploadStream(t *testing.T) {
+	fake := newFakeS3()
+	u := NewUploader("bucket", "eu-central-1", WithClient(fake))
+
+	data := bytes.Repeat([]byte("0123456789"), int(MinPartSize)/4)
+	err := u.UploadStream(context.Background(), "big", bytes.NewReader(data), &StreamOptions{PartSize: MinPartSize, Concurrency: 2})
+	if err != nil {
+		t.Fatalf("upload failed: %v", err)
+	}
+	if !bytes.Equal(fake.objects["bucket/big"], data) {
+		t.Errorf("uploaded object differs")
+	}
+}
+
+func TestUploadStreamAbortAndResume(t *testing.T) {
+	fake := newFakeS3()
+	fake.failPart = 2
+	u := NewUploader("bucket", "eu-central-1", WithClient(fake))
+	data := bytes.Repeat([]byte("0123456789"), int(MinPartSize)/4)
+
+	err := u.UploadStream(context.Background(), "big", bytes.NewReader(data), &StreamOptions{PartSize: MinPartSize})
+	if err == nil || len(fake.aborted) != 1 {
+		t.Fatalf("expected aborted upload, got %v", err)
+	}
+
+	fake.failPart = 2
+	err = u.UploadStream(context.Background(), "big", bytes.NewReader(data), &StreamOptions{PartSize: MinPartSize, Concurrency: 1, Resumable: true})
+	var resumable *ResumableError
+	if !errors.As(err, &resumable) {
+		t.Fatalf("expected resumable error, got %v", err)
+	}
+	if len(fake.aborted) != 1 || len(resumable.State.Parts) != 1 {
+		t.Fatalf("unexpected state after failure: %d aborted, %d parts", len(fake.aborted), len(resumable.State.Parts))
+	}
+
+	err = u.UploadStream(context.Background(), "big", bytes.NewReader(data), &StreamOptions{Resume: resumable.State})
+	if err != nil {
+		t.Fatalf("resumed upload failed: %v", err)
+	}
+	if !bytes.Equal(fake.objects["bucket/big"], data) {
+		t.Errorf("uploaded object differs")
+	}
+
+	changed := append([]byte{}, data...)
+	changed[0] = 'x'
+	fake.failPart = 3
+	err = u.UploadStream(context.Background(), "other", bytes.NewReader(data), &StreamOptions{PartSize: MinPartSize, Resumable: true})
+	if !errors.As(err, &resumable) {
+		t.Fatalf("expected resumable error, got %v", err)
+	}
+	err = u.UploadStream(context.Background(), "other", bytes.NewReader(changed), &StreamOptions{Resume: resumable.State})
+	if err == nil {
+		t.Errorf("resuming with changed content should fail")
+	}
+}
+
+func TestUploadStreamResumeShorterStream(t *testing.T) {
+	fake := newFakeS3()
+	fake.failPart = 3
+	u := NewUploader("bucket", "eu-central-1", WithClient(fake))
+	data := bytes.Repeat([]byte("0123456789"), int(MinPartSize)/4)
+
+	err := u.UploadStream(context.Background(), "big", bytes.NewReader(data), &StreamOptions{PartSize: MinPartSize, Concurrency: 1, Resumable: true})
+	var resumable *ResumableError
+	if !errors.As(err, &resumable) || len(resumable.State.Parts) != 2 {
+		t.Fatalf("expected resumable error after 2 parts, got %v", err)
+	}
+
+	// the stream ends with the first part, the second must not be kept
+	err = u.UploadStream(context.Background(), "big", bytes.NewReader(data[:MinPartSize]), &StreamOptions{Resume: resumable.State})
+	if err == nil {
+		t.Fatalf("resuming with a shorter stream should fail")
+	}
+	if _, exists := fake.objects["bucket/big"]; exists {
+		t.Errorf("object completed from stale parts")
+	}
+}
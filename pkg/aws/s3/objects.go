@@ -0,0 +1,262 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// ErrNotFound is returned when an object or version does not exist.
+var ErrNotFound = errors.New("object not found")
+
+// maxDeleteBatch is the number of keys S3 deletes per request at most.
+const maxDeleteBatch = 1000
+
+// ObjectInfo describes a stored object. `List` fills only Key, Size,
+// ETag, LastModified and StorageClass.
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	ETag         string
+	LastModified time.Time
+	StorageClass string
+	ContentType  string
+	Metadata     map[string]string
+}
+
+// Download returns the content of the object stored at `key`, decrypted
+// if client-side encryption is configured. The caller must close the
+// returned reader. Authentication of decrypted content fails with a read
+// error.
+func (u *Uploader) Download(ctx context.Context, key string) (io.ReadCloser, error) {
+	return u.download(ctx, key, "", "")
+}
+
+// DownloadRange returns `length` bytes of the object stored at `key`
+// starting at `offset`. A negative `length` reads to the end of the
+// object. Ranges cannot be read with client-side encryption.
+func (u *Uploader) DownloadRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	if offset < 0 || length == 0 {
+		return nil, fmt.Errorf("invalid range: offset %d, length %d", offset, length)
+	}
+	if u.opts.clientSide() {
+		return nil, fmt.Errorf("cannot download a range of %s with client-side encryption", key)
+	}
+	byteRange := fmt.Sprintf("bytes=%d-", offset)
+	if length > 0 {
+		byteRange += fmt.Sprint(offset + length - 1)
+	}
+	return u.download(ctx, key, byteRange, "")
+}
+
+// download reads the object stored at `key`, restricted to `byteRange`
+// and `versionID` unless empty.
+func (u *Uploader) download(ctx context.Context, key, byteRange, versionID string) (io.ReadCloser, error) {
+	s3Client, err := u.s3Client()
+	if err != nil {
+		return nil, err
+	}
+	in := &s3.GetObjectInput{
+		Bucket: aws.String(u.bucket),
+		Key:    aws.String(key),
+	}
+	in.Range = optionalString(byteRange)
+	in.VersionId = optionalString(versionID)
+	in.SSECustomerAlgorithm, in.SSECustomerKey, in.SSECustomerKeyMD5 = u.opts.customerKey()
+	out, err := s3Client.GetObject(ctx, in)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", key, notFound(err))
+	}
+	body := io.ReadCloser(&countingReadCloser{ReadCloser: out.Body, onClose: func(n int64) {
+		u.opts.metrics.transferred("download", n)
+	}})
+	if !u.opts.clientSide() {
+		return body, nil
+	}
+	dataKey, err := u.opts.openingKey(out.Metadata)
+	if err != nil {
+		body.Close()
+		return nil, fmt.Errorf("failed to decrypt %s: %w", key, err)
+	}
+	return openStream(dataKey, body), nil
+}
+
+// Head returns the metadata of the object stored at `key`. With
+// client-side encryption, Size is the size of the sealed content.
+func (u *Uploader) Head(ctx context.Context, key string) (*ObjectInfo, error) {
+	s3Client, err := u.s3Client()
+	if err != nil {
+		return nil, err
+	}
+	in := &s3.HeadObjectInput{
+		Bucket: aws.String(u.bucket),
+		Key:    aws.String(key),
+	}
+	in.SSECustomerAlgorithm, in.SSECustomerKey, in.SSECustomerKeyMD5 = u.opts.customerKey()
+	out, err := s3Client.HeadObject(ctx, in)
+	if err != nil {
+		return nil, fmt.Errorf("failed to head %s: %w", key, notFound(err))
+	}
+	return &ObjectInfo{
+		Key:          key,
+		Size:         aws.ToInt64(out.ContentLength),
+		ETag:         aws.ToString(out.ETag),
+		LastModified: aws.ToTime(out.LastModified),
+		StorageClass: string(out.StorageClass),
+		ContentType:  aws.ToString(out.ContentType),
+		Metadata:     out.Metadata,
+	}, nil
+}
+
+// List iterates over all objects whose key starts with `prefix`, fetching
+// further pages as needed. Iteration stops after the first error.
+//
+//	for obj, err := range uploader.List(ctx, "exports/") {
+//		if err != nil {
+//			return err
+//		}
+//		...
+//	}
+func (u *Uploader) List(ctx context.Context, prefix string) iter.Seq2[ObjectInfo, error] {
+	return func(yield func(ObjectInfo, error) bool) {
+		s3Client, err := u.s3Client()
+		if err != nil {
+			yield(ObjectInfo{}, err)
+			return
+		}
+		in := &s3.ListObjectsV2Input{
+			Bucket: aws.String(u.bucket),
+			Prefix: aws.String(prefix),
+		}
+		for {
+			out, err := s3Client.ListObjectsV2(ctx, in)
+			if err != nil {
+				yield(ObjectInfo{}, fmt.Errorf("failed to list %s: %w", prefix, err))
+				return
+			}
+			for _, obj := range out.Contents {
+				info := ObjectInfo{
+					Key:          aws.ToString(obj.Key),
+					Size:         aws.ToInt64(obj.Size),
+					ETag:         aws.ToString(obj.ETag),
+					LastModified: aws.ToTime(obj.LastModified),
+					StorageClass: string(obj.StorageClass),
+				}
+				if !yield(info, nil) {
+					return
+				}
+			}
+			if !aws.ToBool(out.IsTruncated) {
+				return
+			}
+			in.ContinuationToken = out.NextContinuationToken
+		}
+	}
+}
+
+// Delete removes the object stored at `key`. Deleting a missing object
+// is not an error.
+func (u *Uploader) Delete(ctx context.Context, key string) error {
+	s3Client, err := u.s3Client()
+	if err != nil {
+		return err
+	}
+	_, err = s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(u.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete %s: %w", key, err)
+	}
+	return nil
+}
+
+// DeleteMany removes the objects stored at `keys`, batching requests as
+// needed. All keys are attempted, even if a batch fails; the error lists
+// the keys that failed and the batches S3 rejected.
+func (u *Uploader) DeleteMany(ctx context.Context, keys []string) error {
+	s3Client, err := u.s3Client()
+	if err != nil {
+		return err
+	}
+	var (
+		errs   []error
+		failed []string
+	)
+	for start := 0; start < len(keys); start += maxDeleteBatch {
+		batch := keys[start:min(start+maxDeleteBatch, len(keys))]
+		objects := make([]types.ObjectIdentifier, 0, len(batch))
+		for _, key := range batch {
+			objects = append(objects, types.ObjectIdentifier{Key: aws.String(key)})
+		}
+		out, err := s3Client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(u.bucket),
+			Delete: &types.Delete{Objects: objects, Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to delete %d objects from %s: %w", len(batch), batch[0], err))
+			continue
+		}
+		for _, e := range out.Errors {
+			failed = append(failed, fmt.Sprintf("%s (%s)", aws.ToString(e.Key), aws.ToString(e.Code)))
+		}
+	}
+	if len(failed) > 0 {
+		errs = append(errs, fmt.Errorf("failed to delete %d objects: %s", len(failed), strings.Join(failed, ", ")))
+	}
+	return errors.Join(errs...)
+}
+
+// Copy copies the object stored at `srcKey` to `dstKey` within the
+// bucket, including its metadata.
+func (u *Uploader) Copy(ctx context.Context, srcKey, dstKey string) error {
+	s3Client, err := u.s3Client()
+	if err != nil {
+		return err
+	}
+	in := &s3.CopyObjectInput{
+		Bucket:     aws.String(u.bucket),
+		Key:        aws.String(dstKey),
+		CopySource: aws.String(copySource(u.bucket, srcKey, "")),
+	}
+	in.ServerSideEncryption, in.SSEKMSKeyId = u.opts.serverSide()
+	in.SSECustomerAlgorithm, in.SSECustomerKey, in.SSECustomerKeyMD5 = u.opts.customerKey()
+	in.CopySourceSSECustomerAlgorithm, in.CopySourceSSECustomerKey, in.CopySourceSSECustomerKeyMD5 = u.opts.customerKey()
+	_, err = s3Client.CopyObject(ctx, in)
+	if err != nil {
+		return fmt.Errorf("failed to copy %s to %s: %w", srcKey, dstKey, notFound(err))
+	}
+	return nil
+}
+
+// copySource builds the URL encoded copy source of an object version.
+func copySource(bucket, key, versionID string) string {
+	source := url.PathEscape(bucket) + "/" + strings.ReplaceAll(url.PathEscape(key), "%2F", "/")
+	if versionID != "" {
+		source += "?versionId=" + url.QueryEscape(versionID)
+	}
+	return source
+}
+
+// notFound maps the SDK errors for missing objects and versions to
+// `ErrNotFound`.
+func notFound(err error) error {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "NoSuchKey", "NoSuchVersion", "NotFound":
+			return fmt.Errorf("%w: %w", ErrNotFound, err)
+		}
+	}
+	return err
+}
@@ -0,0 +1,117 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestList(t *testing.T) {
+	fake := newFakeS3()
+	fake.pageSize = 2
+	for _, key := range []string{"a/1", "a/2", "a/3", "a/4", "a/5", "b/1"} {
+		fake.objects["bucket/"+key] = []byte(key)
+	}
+	u := NewUploader("bucket", "eu-central-1", WithClient(fake))
+
+	var keys []string
+	for obj, err := range u.List(context.Background(), "a/") {
+		if err != nil {
+			t.Fatalf("list failed: %v", err)
+		}
+		keys = append(keys, obj.Key)
+	}
+	if strings.Join(keys, ",") != "a/1,a/2,a/3,a/4,a/5" {
+		t.Errorf("unexpected keys across pages: %v", keys)
+	}
+
+	keys = nil
+	for obj := range u.List(context.Background(), "a/") {
+		keys = append(keys, obj.Key)
+		if len(keys) == 3 {
+			break
+		}
+	}
+	if len(keys) != 3 {
+		t.Errorf("expected iteration to stop after 3 keys, got %v", keys)
+	}
+}
+
+func TestDeleteMany(t *testing.T) {
+	fake := newFakeS3()
+	var keys []string
+	for i := 0; i < 2500; i++ {
+		key := fmt.Sprintf("k/%04d", i)
+		keys = append(keys, key)
+		fake.objects["bucket/"+key] = []byte{}
+	}
+	fake.failDeleteBatch = 2
+	fake.deleteErrors = map[string]string{"k/2100": "AccessDenied"}
+	u := NewUploader("bucket", "eu-central-1", WithClient(fake))
+
+	err := u.DeleteMany(context.Background(), keys)
+	if err == nil {
+		t.Fatalf("expected errors")
+	}
+	for _, part := range []string{"failed to delete 1000 objects from k/1000", "k/2100 (AccessDenied)"} {
+		if !strings.Contains(err.Error(), part) {
+			t.Errorf("error %q lacks %q", err, part)
+		}
+	}
+	if fake.deleteBatches != 3 {
+		t.Errorf("expected 3 batches, got %d", fake.deleteBatches)
+	}
+	// the keys of the failed batch and the key reported are left
+	if len(fake.objects) != 1001 {
+		t.Errorf("expected 1001 objects left, got %d", len(fake.objects))
+	}
+	if _, ok := fake.objects["bucket/k/2499"]; ok {
+		t.Errorf("batch after the failed one was not attempted")
+	}
+}
+
+func TestDownloadRangeAndCopy(t *testing.T) {
+	ctx := context.Background()
+	fake := newFakeS3()
+	fake.objects["bucket/src/a b.txt"] = []byte("hello world")
+	fake.meta["bucket/src/a b.txt"] = map[string]string{"owner": "test"}
+	u := NewUploader("bucket", "eu-central-1", WithClient(fake))
+
+	for _, tc := range []struct {
+		offset, length int64
+		expected       string
+	}{{0, 5, "hello"}, {6, -1, "world"}, {6, 100, "world"}} {
+		body, err := u.DownloadRange(ctx, "src/a b.txt", tc.offset, tc.length)
+		if err != nil {
+			t.Fatalf("range download failed: %v", err)
+		}
+		data, err := io.ReadAll(body)
+		body.Close()
+		if err != nil || string(data) != tc.expected {
+			t.Errorf("range %d+%d: got %q, expected %q", tc.offset, tc.length, data, tc.expected)
+		}
+	}
+	if _, err := u.DownloadRange(ctx, "src/a b.txt", -1, 5); err == nil {
+		t.Errorf("expected error for negative offset")
+	}
+
+	if err := u.Copy(ctx, "src/a b.txt", "dst/copy.txt"); err != nil {
+		t.Fatalf("copy failed: %v", err)
+	}
+	if string(fake.objects["bucket/dst/copy.txt"]) != "hello world" || fake.meta["bucket/dst/copy.txt"]["owner"] != "test" {
+		t.Errorf("copy differs from source")
+	}
+	if err := u.Copy(ctx, "missing", "dst/other"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	if err := u.Delete(ctx, "dst/copy.txt"); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if _, err := u.Head(ctx, "dst/copy.txt"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound after delete, got %v", err)
+	}
+}
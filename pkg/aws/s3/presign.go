@@ -0,0 +1,174 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// maxPresignTTL is the longest validity SigV4 allows.
+const maxPresignTTL = 7 * 24 * time.Hour
+
+// PresignedRequest is a request signed on behalf of a client that has no
+// credentials of its own.
+type PresignedRequest struct {
+	Method string
+	URL    string
+	// Header holds headers that were signed and must be sent along.
+	Header http.Header
+}
+
+// PresignedPost is an HTML form upload signed on behalf of a client. The
+// client posts Fields as multipart/form-data to URL, followed by the
+// file as the last field named "file".
+type PresignedPost struct {
+	URL    string
+	Fields map[string]string
+}
+
+// PostOptions constrain uploads via `PresignPost`.
+type PostOptions struct {
+	// ContentType the upload must declare. Empty allows any.
+	ContentType string
+	// MinSize and MaxSize limit the size of the upload in bytes. A zero
+	// MaxSize does not limit it.
+	MinSize int64
+	MaxSize int64
+	// Metadata is stored as user metadata (x-amz-meta-*).
+	Metadata map[string]string
+}
+
+// PresignGet returns a URL to download the object stored at `key` that
+// is valid for `ttl`.
+func (u *Uploader) PresignGet(key string, ttl time.Duration) (string, error) {
+	presigner, err := u.presigner(ttl)
+	if err != nil {
+		return "", err
+	}
+	req, err := presigner.PresignGetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String(u.bucket),
+		Key:    aws.String(key),
+	}, s3.WithPresignExpires(ttl))
+	if err != nil {
+		return "", fmt.Errorf("failed to presign download of %s: %w", key, err)
+	}
+	return req.URL, nil
+}
+
+// PresignPut returns a request to upload an object to `key` that is
+// valid for `ttl`. The properties set in `opts`, which may be nil, are
+// signed and become part of the returned headers; the content type is
+// only signed if set explicitly.
+func (u *Uploader) PresignPut(key string, ttl time.Duration, opts *UploadOptions) (*PresignedRequest, error) {
+	presigner, err := u.presigner(ttl)
+	if err != nil {
+		return nil, err
+	}
+	if opts == nil {
+		opts = &UploadOptions{}
+	}
+	in := &s3.PutObjectInput{
+		Bucket:             aws.String(u.bucket),
+		Key:                aws.String(key),
+		ContentType:        optionalString(opts.ContentType),
+		ContentDisposition: optionalString(opts.ContentDisposition),
+		CacheControl:       optionalString(opts.CacheControl),
+		Metadata:           opts.Metadata,
+		Tagging:            optionalString(encodeTags(opts.Tags)),
+		StorageClass:       types.StorageClass(opts.StorageClass),
+		ACL:                types.ObjectCannedACL(opts.ACL),
+		ObjectLockMode:     types.ObjectLockMode(opts.ObjectLockMode),
+	}
+	if !opts.ObjectLockRetainUntil.IsZero() {
+		in.ObjectLockRetainUntilDate = aws.Time(opts.ObjectLockRetainUntil)
+	}
+	in.ServerSideEncryption, in.SSEKMSKeyId = u.opts.serverSide()
+	req, err := presigner.PresignPutObject(context.Background(), in, s3.WithPresignExpires(ttl))
+	if err != nil {
+		return nil, fmt.Errorf("failed to presign upload of %s: %w", key, err)
+	}
+	return &PresignedRequest{Method: req.Method, URL: req.URL, Header: req.SignedHeader}, nil
+}
+
+// PresignPost returns a form upload to `key` that is valid for `ttl`. In
+// contrast to `PresignPut`, S3 enforces the constraints in `opts`, which
+// may be nil, through the signed policy.
+func (u *Uploader) PresignPost(key string, ttl time.Duration, opts *PostOptions) (*PresignedPost, error) {
+	presigner, err := u.presigner(ttl)
+	if err != nil {
+		return nil, err
+	}
+	if opts == nil {
+		opts = &PostOptions{}
+	}
+	if opts.MinSize < 0 || (opts.MaxSize != 0 && opts.MaxSize < opts.MinSize) {
+		return nil, fmt.Errorf("invalid size range %d-%d", opts.MinSize, opts.MaxSize)
+	}
+
+	// fields the form has to contain besides those added by the SDK
+	fields := map[string]string{}
+	if opts.ContentType != "" {
+		fields["Content-Type"] = opts.ContentType
+	}
+	for k, v := range opts.Metadata {
+		fields["x-amz-meta-"+strings.ToLower(k)] = v
+	}
+	if algorithm, kmsKeyID := u.opts.serverSide(); algorithm != "" {
+		fields["x-amz-server-side-encryption"] = string(algorithm)
+		if kmsKeyID != nil {
+			fields["x-amz-server-side-encryption-aws-kms-key-id"] = *kmsKeyID
+		}
+	}
+	var conditions []any
+	for k, v := range fields {
+		conditions = append(conditions, map[string]string{k: v})
+	}
+	if opts.MaxSize > 0 {
+		conditions = append(conditions, []any{"content-length-range", opts.MinSize, opts.MaxSize})
+	}
+
+	req, err := presigner.PresignPostObject(context.Background(), &s3.PutObjectInput{
+		Bucket: aws.String(u.bucket),
+		Key:    aws.String(key),
+	}, func(o *s3.PresignPostOptions) {
+		o.Expires = ttl
+		o.Conditions = conditions
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to presign form upload of %s: %w", key, err)
+	}
+	for k, v := range req.Values {
+		fields[k] = v
+	}
+	return &PresignedPost{URL: req.URL, Fields: fields}, nil
+}
+
+// presigner returns a client for presigning, failing for settings a
+// client without credentials cannot satisfy.
+func (u *Uploader) presigner(ttl time.Duration) (*s3.PresignClient, error) {
+	if ttl <= 0 || ttl > maxPresignTTL {
+		return nil, fmt.Errorf("presign ttl %v out of range (0, %v]", ttl, maxPresignTTL)
+	}
+	if u.opts.clientSide() {
+		return nil, errors.New("cannot presign with client-side encryption")
+	}
+	if u.opts.sseCustomerKey != nil {
+		return nil, errors.New("cannot presign with SSE-C without handing out the key")
+	}
+	client, err := u.s3Client()
+	if err != nil {
+		return nil, err
+	}
+	s3Client, ok := client.(*s3.Client)
+	if !ok {
+		return nil, fmt.Errorf("cannot presign with client of type %T", client)
+	}
+	return s3.NewPresignClient(s3Client), nil
+}
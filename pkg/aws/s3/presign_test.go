@@ -0,0 +1,73 @@
+package s3
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPresign(t *testing.T) {
+	u := NewUploader("bucket", "eu-central-1", WithStaticCredentials("AKID", "SECRET", ""))
+
+	get, err := u.PresignGet("docs/report.pdf", time.Hour)
+	if err != nil {
+		t.Fatalf("presign get failed: %v", err)
+	}
+	parsed, err := url.Parse(get)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Query().Get("X-Amz-Expires") != "3600" || !strings.HasSuffix(parsed.Path, "/docs/report.pdf") {
+		t.Errorf("unexpected presigned url: %s", get)
+	}
+
+	put, err := u.PresignPut("upload.pdf", time.Minute, &UploadOptions{ContentType: "application/pdf"})
+	if err != nil {
+		t.Fatalf("presign put failed: %v", err)
+	}
+	if put.Header.Get("Content-Type") != "application/pdf" {
+		t.Errorf("content type not part of signed headers: %v", put.Header)
+	}
+
+	if _, err := u.PresignGet("key", 8*24*time.Hour); err == nil {
+		t.Errorf("expected error for ttl beyond a week")
+	}
+	if _, err := NewUploader("bucket", "eu-central-1", WithClient(newFakeS3())).PresignGet("key", time.Hour); err == nil {
+		t.Errorf("expected error presigning with a fake client")
+	}
+}
+
+func TestPresignPost(t *testing.T) {
+	u := NewUploader("bucket", "eu-central-1", WithStaticCredentials("AKID", "SECRET", ""))
+	post, err := u.PresignPost("uploads/file.pdf", time.Hour, &PostOptions{ContentType: "application/pdf", MaxSize: 1 << 20})
+	if err != nil {
+		t.Fatalf("presign post failed: %v", err)
+	}
+	if post.Fields["key"] != "uploads/file.pdf" || post.Fields["Content-Type"] != "application/pdf" {
+		t.Errorf("unexpected fields: %v", post.Fields)
+	}
+	if !strings.Contains(post.URL, "bucket") {
+		t.Errorf("unexpected url: %s", post.URL)
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(post.Fields["policy"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !json.Valid(raw) {
+		t.Fatalf("invalid policy: %s", raw)
+	}
+	if !strings.Contains(string(raw), `["content-length-range",0,1048576]`) {
+		t.Errorf("size range missing in policy: %s", raw)
+	}
+
+	if !strings.Contains(string(raw), `{"Content-Type":"application/pdf"}`) {
+		t.Errorf("content type missing in policy: %s", raw)
+	}
+	if post.Fields["X-Amz-Signature"] == "" {
+		t.Errorf("policy not signed: %v", post.Fields)
+	}
+}
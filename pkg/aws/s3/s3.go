@@ -3,42 +3,396 @@ package s3
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"sync"
+	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/paraopsde/go-x/pkg/crypto"
+	"github.com/paraopsde/go-x/pkg/util"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
 )
 
 type Uploader struct {
 	bucket string
 	region string
+	opts   options
+
+	clientOnce sync.Once
+	client     Client
+	transfer   *manager.Uploader
+	clientErr  error
+}
+
+// Client is the part of the S3 API used by the Uploader. It is
+// implemented by *s3.Client.
+type Client interface {
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+	CopyObject(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error)
+	DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error)
+	DeleteObjects(ctx context.Context, params *s3.DeleteObjectsInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error)
+	ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+	CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error)
+	UploadPart(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error)
+	CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error)
+	AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error)
+	ListObjectVersions(ctx context.Context, params *s3.ListObjectVersionsInput, optFns ...func(*s3.Options)) (*s3.ListObjectVersionsOutput, error)
+	GetBucketLifecycleConfiguration(ctx context.Context, params *s3.GetBucketLifecycleConfigurationInput, optFns ...func(*s3.Options)) (*s3.GetBucketLifecycleConfigurationOutput, error)
+	PutBucketLifecycleConfiguration(ctx context.Context, params *s3.PutBucketLifecycleConfigurationInput, optFns ...func(*s3.Options)) (*s3.PutBucketLifecycleConfigurationOutput, error)
+	DeleteBucketLifecycle(ctx context.Context, params *s3.DeleteBucketLifecycleInput, optFns ...func(*s3.Options)) (*s3.DeleteBucketLifecycleOutput, error)
+}
+
+// Option configures an Uploader.
+type Option func(*options)
+
+type options struct {
+	client      Client
+	endpoint    string
+	credentials aws.CredentialsProvider
+	pathStyle   bool
+	tlsConfig   *tls.Config
+	caPEM       []byte
+	retry       RetryPolicy
+
+	metrics        *Metrics
+	tracerProvider trace.TracerProvider
+
+	// server-side encryption
+	sse            types.ServerSideEncryption
+	sseKMSKeyID    string
+	sseCustomerKey []byte
+	// client-side encryption
+	cseKey    *crypto.Key
+	cseHolder *crypto.AsymKey
+}
+
+// WithClient makes the Uploader use `client` instead of creating one,
+// e.g. a fake for tests. All other options affecting the client are
+// ignored then.
+func WithClient(client Client) Option {
+	return func(o *options) {
+		o.client = client
+	}
+}
+
+// WithEndpoint points the client at an S3 compatible endpoint instead of
+// AWS, e.g. "http://localhost:9000" for a local MinIO.
+func WithEndpoint(endpoint string) Option {
+	return func(o *options) {
+		o.endpoint = endpoint
+	}
+}
+
+// WithStaticCredentials replaces the default credential chain
+// (environment, shared config, instance role) by fixed credentials.
+func WithStaticCredentials(accessKeyID, secretAccessKey, sessionToken string) Option {
+	return func(o *options) {
+		o.credentials = credentials.NewStaticCredentialsProvider(accessKeyID, secretAccessKey, sessionToken)
+	}
+}
+
+// WithPathStyle addresses buckets as part of the path instead of the
+// host name, as most S3 compatible servers require.
+func WithPathStyle() Option {
+	return func(o *options) {
+		o.pathStyle = true
+	}
 }
 
-func NewUploader(bucket, region string) *Uploader {
-	return &Uploader{
+// WithTLSConfig makes the client connect with `cfg`, e.g. to present a
+// client certificate to an on-premise endpoint.
+func WithTLSConfig(cfg *tls.Config) Option {
+	return func(o *options) {
+		o.tlsConfig = cfg.Clone()
+	}
+}
+
+// WithCACertificates makes the client trust the PEM encoded certificates
+// in `pem` in addition to the system roots, e.g. the CA of an
+// on-premise endpoint.
+func WithCACertificates(pem []byte) Option {
+	return func(o *options) {
+		o.caPEM = append([]byte{}, pem...)
+	}
+}
+
+// NewUploader creates an Uploader for `bucket` in `region`. The S3 client
+// is created on first use from the default AWS configuration and shared
+// by all subsequent calls; errors creating it are returned by those
+// calls. With a custom endpoint, `region` defaults to "us-east-1" if
+// empty, which most S3 compatible servers expect.
+func NewUploader(bucket, region string, opts ...Option) *Uploader {
+	u := &Uploader{
 		bucket: bucket,
 		region: region,
 	}
+	for _, opt := range opts {
+		opt(&u.opts)
+	}
+	return u
+}
+
+func (u *Uploader) s3Client() (Client, error) {
+	u.clientOnce.Do(func() {
+		if err := u.opts.validateEncryption(); err != nil {
+			u.clientErr = err
+			return
+		}
+		u.client = u.opts.client
+		if u.client == nil {
+			u.client, u.clientErr = u.newClient()
+			if u.clientErr != nil {
+				return
+			}
+		}
+		u.transfer = manager.NewUploader(u.client)
+	})
+	return u.client, u.clientErr
+}
+
+func (u *Uploader) newClient() (Client, error) {
+	region := u.region
+	if region == "" && u.opts.endpoint != "" {
+		region = "us-east-1"
+	}
+	loadOpts := []func(*config.LoadOptions) error{config.WithRegion(region)}
+	if u.opts.credentials != nil {
+		loadOpts = append(loadOpts, config.WithCredentialsProvider(u.opts.credentials))
+	}
+	tlsConfig, err := u.opts.tls()
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		loadOpts = append(loadOpts, config.WithHTTPClient(awshttp.NewBuildableClient().WithTransportOptions(func(tr *http.Transport) {
+			tr.TLSClientConfig = tlsConfig
+		})))
+	}
+	cfg, err := config.LoadDefaultConfig(context.Background(), loadOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	return s3.NewFromConfig(cfg, func(o *s3.Options) {
+		o.Retryer = u.opts.retryer()
+		o.APIOptions = append(o.APIOptions, u.opts.instrument(u.bucket))
+		if u.opts.endpoint != "" {
+			o.BaseEndpoint = aws.String(u.opts.endpoint)
+		}
+		o.UsePathStyle = u.opts.pathStyle
+	}), nil
 }
 
+// tls returns the TLS configuration of the client, or nil to keep the
+// default.
+func (o *options) tls() (*tls.Config, error) {
+	if o.tlsConfig == nil && o.caPEM == nil {
+		return nil, nil
+	}
+	cfg := o.tlsConfig
+	if cfg == nil {
+		cfg = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	if o.caPEM != nil {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if cfg.RootCAs != nil {
+			pool = cfg.RootCAs.Clone()
+		}
+		if !pool.AppendCertsFromPEM(o.caPEM) {
+			return nil, errors.New("no certificates found in CA PEM")
+		}
+		cfg = cfg.Clone()
+		cfg.RootCAs = pool
+	}
+	return cfg, nil
+}
+
+// UploadOptions set the properties of uploaded objects. All fields are
+// optional.
+type UploadOptions struct {
+	// ContentType is detected from the key's extension or, failing
+	// that, from the content if left empty.
+	ContentType        string
+	ContentDisposition string
+	CacheControl       string
+	// Metadata is stored as user metadata (x-amz-meta-*).
+	Metadata map[string]string
+	// Tags are stored as object tags.
+	Tags map[string]string
+	// StorageClass like "STANDARD_IA" or "GLACIER_IR".
+	StorageClass string
+	// ACL is a canned ACL like "private" or "public-read".
+	ACL string
+	// ObjectLockMode ("GOVERNANCE" or "COMPLIANCE") and
+	// ObjectLockRetainUntil set a retention period on the object. The
+	// bucket must have object lock enabled.
+	ObjectLockMode        string
+	ObjectLockRetainUntil time.Time
+	// IfNotExists makes the upload fail with `ErrExists` instead of
+	// replacing an object stored at the key.
+	IfNotExists bool
+}
+
+// Upload stores `data` at `key` with the content type detected. The
+// content is encrypted as configured for the Uploader. The outcome is
+// logged to the logger of `ctx`.
+//
+// The MD5 and SHA-256 of the content are sent along, so S3 rejects
+// content damaged in transit, and the checksums S3 returns are verified.
+// Data larger than a part of the transfer manager is uploaded in parts,
+// each protected by its SHA-256; the checksums and ETags S3 returns for
+// the parts and the ETag of the object are verified as well.
 func (u *Uploader) Upload(ctx context.Context, key string, data []byte) error {
+	return u.UploadWithOptions(ctx, key, data, nil)
+}
+
+// UploadWithOptions stores `data` at `key` with the properties set in
+// `opts`, which may be nil.
+func (u *Uploader) UploadWithOptions(ctx context.Context, key string, data []byte, opts *UploadOptions) error {
+	log, ctx := util.CtxLogOrInjectNew(ctx)
+	start := time.Now()
+	err := u.upload(ctx, key, data, opts)
+	u.logUpload(log, key, int64(len(data)), start, err)
+	return err
+}
 
-	sess := session.Must(session.NewSessionWithOptions(session.Options{
-		Config:            aws.Config{Region: aws.String(u.region)},
-		SharedConfigState: session.SharedConfigEnable,
-	}))
+func (u *Uploader) upload(ctx context.Context, key string, data []byte, opts *UploadOptions) error {
+	if _, err := u.s3Client(); err != nil {
+		return err
+	}
 
-	s3Client := s3.New(sess)
+	if opts == nil {
+		opts = &UploadOptions{}
+	}
+	in := &s3.PutObjectInput{
+		Bucket:      aws.String(u.bucket),
+		Key:         aws.String(key),
+		ContentType: aws.String(detectContentType(key, opts.ContentType, data)),
+	}
+	metadata := opts.Metadata
+	if u.opts.clientSide() {
+		dataKey, extra, err := u.opts.dataKey()
+		if err != nil {
+			return err
+		}
+		if data, err = dataKey.ChachaSealWithOptions(data, crypto.SealOptions{}); err != nil {
+			return fmt.Errorf("failed to seal %s: %w", key, err)
+		}
+		metadata = withMetadata(metadata, extra)
+	}
+	in.Body = bytes.NewReader(data)
+	in.ContentDisposition = optionalString(opts.ContentDisposition)
+	in.CacheControl = optionalString(opts.CacheControl)
+	in.Metadata = metadata
+	in.Tagging = optionalString(encodeTags(opts.Tags))
+	in.StorageClass = types.StorageClass(opts.StorageClass)
+	in.ACL = types.ObjectCannedACL(opts.ACL)
+	in.ObjectLockMode = types.ObjectLockMode(opts.ObjectLockMode)
+	if !opts.ObjectLockRetainUntil.IsZero() {
+		in.ObjectLockRetainUntilDate = aws.Time(opts.ObjectLockRetainUntil)
+	}
+	in.ServerSideEncryption, in.SSEKMSKeyId = u.opts.serverSide()
+	in.SSECustomerAlgorithm, in.SSECustomerKey, in.SSECustomerKeyMD5 = u.opts.customerKey()
+	in.IfNoneMatch = ifNoneMatch(opts.IfNotExists)
 
-	_, err := s3Client.PutObjectWithContext(ctx, &s3.PutObjectInput{
-		Bucket: aws.String(u.bucket),
-		Key:    aws.String(key),
-		Body:   bytes.NewReader(data),
-	})
+	// the transfer manager switches to a multipart upload for data larger
+	// than a part, leaving the checksums of the parts to the SDK
+	sums := newContentSums(data)
+	if int64(len(data)) <= u.transfer.PartSize {
+		in.ContentMD5 = sums.contentMD5()
+		in.ChecksumSHA256 = sums.checksumSHA256()
+	} else {
+		in.ChecksumAlgorithm = types.ChecksumAlgorithmSha256
+	}
+	out, err := u.transfer.Upload(ctx, in)
 	if err != nil {
-		return fmt.Errorf("failed to upload PDF file to S3: %w", err)
+		return fmt.Errorf("failed to upload %s: %w", key, preconditionFailed(err))
+	}
+	etag := out.ETag
+	if !u.opts.etagIsMD5() {
+		etag = nil
+	}
+	if out.UploadID == "" {
+		err = sums.verify(etag, out.ChecksumSHA256)
+	} else {
+		err = verifyParts(data, u.partSize(int64(len(data))), out.CompletedParts, etag)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %w", key, err)
 	}
 
 	return nil
 }
+
+// partSize returns the part size the transfer manager uses for `size`
+// bytes, which it raises to stay within its maximum number of parts.
+func (u *Uploader) partSize(size int64) int64 {
+	if size/u.transfer.PartSize >= int64(u.transfer.MaxUploadParts) {
+		return size/int64(u.transfer.MaxUploadParts) + 1
+	}
+	return u.transfer.PartSize
+}
+
+// logUpload logs the outcome of an upload and counts the bytes
+// uploaded.
+func (u *Uploader) logUpload(log *zap.Logger, key string, size int64, start time.Time, err error) {
+	fields := []zap.Field{
+		zap.String("bucket", u.bucket),
+		zap.String("key", key),
+		zap.Int64("size", size),
+		zap.Duration("duration", time.Since(start)),
+	}
+	if err != nil {
+		log.Error("Failed to upload object.", append(fields, zap.Error(err))...)
+		return
+	}
+	u.opts.metrics.transferred("upload", size)
+	log.Info("Uploaded object.", fields...)
+}
+
+// detectContentType returns `contentType` if set, otherwise the type
+// registered for the extension of `key` or, failing that, the type
+// sniffed from the start of the content.
+func detectContentType(key, contentType string, head []byte) string {
+	if contentType != "" {
+		return contentType
+	}
+	if byExt := mime.TypeByExtension(path.Ext(key)); byExt != "" {
+		return byExt
+	}
+	return http.DetectContentType(head)
+}
+
+// encodeTags encodes tags as expected by the x-amz-tagging header.
+func encodeTags(tags map[string]string) string {
+	values := url.Values{}
+	for k, v := range tags {
+		values.Set(k, v)
+	}
+	return values.Encode()
+}
+
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return aws.String(s)
+}
@@ -0,0 +1,321 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+type fakeS3 struct {
+	Client
+	mu      sync.Mutex
+	objects map[string][]byte
+	meta    map[string]map[string]string
+	uploads map[string]map[int32][]byte
+	aborted []string
+	// failPart makes uploading the part with this number fail once
+	failPart int32
+	// corrupt makes the fake return wrong ETags
+	corrupt bool
+	// pageSize splits listings into pages of this many objects
+	pageSize int
+	// deleteErrors reports the error code for keys DeleteObjects fails
+	deleteErrors map[string]string
+	// failDeleteBatch makes the DeleteObjects call with this number fail
+	failDeleteBatch int
+	deleteBatches   int
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{objects: map[string][]byte{}, meta: map[string]map[string]string{}, uploads: map[string]map[int32][]byte{}}
+}
+
+func (f *fakeS3) PutObject(ctx context.Context, in *s3.PutObjectInput, _ ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	body, err := io.ReadAll(in.Body)
+	if err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.precondition(aws.ToString(in.Bucket)+"/"+aws.ToString(in.Key), in.IfNoneMatch); err != nil {
+		return nil, err
+	}
+	f.objects[aws.ToString(in.Bucket)+"/"+aws.ToString(in.Key)] = body
+	f.meta[aws.ToString(in.Bucket)+"/"+aws.ToString(in.Key)] = in.Metadata
+	return &s3.PutObjectOutput{ETag: f.etag(body), ChecksumSHA256: in.ChecksumSHA256}, nil
+}
+
+func (f *fakeS3) etag(body []byte) *string {
+	if f.corrupt {
+		body = append([]byte("x"), body...)
+	}
+	return aws.String(fmt.Sprintf(`"%x"`, md5.Sum(body)))
+}
+
+func (f *fakeS3) precondition(key string, ifNoneMatch *string) error {
+	if _, exists := f.objects[key]; exists && aws.ToString(ifNoneMatch) == "*" {
+		return &smithy.GenericAPIError{Code: "PreconditionFailed", Message: "object exists"}
+	}
+	return nil
+}
+
+func (f *fakeS3) GetObject(ctx context.Context, in *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := aws.ToString(in.Bucket) + "/" + aws.ToString(in.Key)
+	if in.VersionId != nil {
+		// versions other than the current one are stored as "key?versionId=v"
+		key += "?versionId=" + aws.ToString(in.VersionId)
+	}
+	body, ok := f.objects[key]
+	if !ok && in.VersionId != nil {
+		return nil, &smithy.GenericAPIError{Code: "NoSuchVersion", Message: "no such version"}
+	}
+	if !ok {
+		return nil, &types.NoSuchKey{Message: aws.String("no such key")}
+	}
+	if in.Range != nil {
+		var first, last int
+		if n, _ := fmt.Sscanf(aws.ToString(in.Range), "bytes=%d-%d", &first, &last); n == 0 {
+			return nil, &smithy.GenericAPIError{Code: "InvalidRange"}
+		} else if n == 1 {
+			last = len(body) - 1
+		}
+		body = body[first:min(last+1, len(body))]
+	}
+	return &s3.GetObjectOutput{
+		Body:     io.NopCloser(bytes.NewReader(body)),
+		Metadata: f.meta[key],
+	}, nil
+}
+
+func (f *fakeS3) HeadObject(ctx context.Context, in *s3.HeadObjectInput, _ ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	body, ok := f.objects[aws.ToString(in.Bucket)+"/"+aws.ToString(in.Key)]
+	if !ok {
+		return nil, &types.NotFound{Message: aws.String("not found")}
+	}
+	return &s3.HeadObjectOutput{
+		ContentLength: aws.Int64(int64(len(body))),
+		Metadata:      f.meta[aws.ToString(in.Bucket)+"/"+aws.ToString(in.Key)],
+	}, nil
+}
+
+// ListObjectsV2 returns the objects in key order, on pages of
+// `pageSize` objects if set.
+func (f *fakeS3) ListObjectsV2(ctx context.Context, in *s3.ListObjectsV2Input, _ ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var keys []string
+	for key := range f.objects {
+		bucket, name, _ := strings.Cut(key, "/")
+		if bucket == aws.ToString(in.Bucket) && strings.HasPrefix(name, aws.ToString(in.Prefix)) && name > aws.ToString(in.ContinuationToken) {
+			keys = append(keys, name)
+		}
+	}
+	sort.Strings(keys)
+	out := &s3.ListObjectsV2Output{IsTruncated: aws.Bool(false)}
+	if f.pageSize > 0 && len(keys) > f.pageSize {
+		keys = keys[:f.pageSize]
+		out.IsTruncated = aws.Bool(true)
+		out.NextContinuationToken = aws.String(keys[len(keys)-1])
+	}
+	for _, name := range keys {
+		body := f.objects[aws.ToString(in.Bucket)+"/"+name]
+		out.Contents = append(out.Contents, types.Object{
+			Key:  aws.String(name),
+			Size: aws.Int64(int64(len(body))),
+			ETag: f.etag(body),
+		})
+	}
+	return out, nil
+}
+
+func (f *fakeS3) DeleteObjects(ctx context.Context, in *s3.DeleteObjectsInput, _ ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.deleteBatches++
+	if f.deleteBatches == f.failDeleteBatch {
+		return nil, &smithy.GenericAPIError{Code: "InternalError", Message: "batch failed"}
+	}
+	out := &s3.DeleteObjectsOutput{}
+	for _, obj := range in.Delete.Objects {
+		if code, ok := f.deleteErrors[aws.ToString(obj.Key)]; ok {
+			out.Errors = append(out.Errors, types.Error{Key: obj.Key, Code: aws.String(code)})
+			continue
+		}
+		delete(f.objects, aws.ToString(in.Bucket)+"/"+aws.ToString(obj.Key))
+	}
+	return out, nil
+}
+
+func (f *fakeS3) DeleteObject(ctx context.Context, in *s3.DeleteObjectInput, _ ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.objects, aws.ToString(in.Bucket)+"/"+aws.ToString(in.Key))
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+func (f *fakeS3) CopyObject(ctx context.Context, in *s3.CopyObjectInput, _ ...func(*s3.Options)) (*s3.CopyObjectOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	source, err := url.PathUnescape(aws.ToString(in.CopySource))
+	if err != nil {
+		return nil, err
+	}
+	body, ok := f.objects[source]
+	if !ok {
+		return nil, &types.NoSuchKey{Message: aws.String("no such key")}
+	}
+	f.objects[aws.ToString(in.Bucket)+"/"+aws.ToString(in.Key)] = body
+	f.meta[aws.ToString(in.Bucket)+"/"+aws.ToString(in.Key)] = f.meta[source]
+	return &s3.CopyObjectOutput{}, nil
+}
+
+func (f *fakeS3) CreateMultipartUpload(ctx context.Context, in *s3.CreateMultipartUploadInput, _ ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	id := fmt.Sprintf("upload-%d", len(f.uploads))
+	f.uploads[id] = map[int32][]byte{}
+	f.meta[aws.ToString(in.Bucket)+"/"+aws.ToString(in.Key)] = in.Metadata
+	return &s3.CreateMultipartUploadOutput{UploadId: aws.String(id)}, nil
+}
+
+func (f *fakeS3) UploadPart(ctx context.Context, in *s3.UploadPartInput, _ ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+	body, err := io.ReadAll(in.Body)
+	if err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if aws.ToInt32(in.PartNumber) == f.failPart {
+		f.failPart = 0
+		return nil, errors.New("injected failure")
+	}
+	f.uploads[aws.ToString(in.UploadId)][aws.ToInt32(in.PartNumber)] = body
+	return &s3.UploadPartOutput{ETag: f.etag(body), ChecksumSHA256: in.ChecksumSHA256}, nil
+}
+
+func (f *fakeS3) CompleteMultipartUpload(ctx context.Context, in *s3.CompleteMultipartUploadInput, _ ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.precondition(aws.ToString(in.Bucket)+"/"+aws.ToString(in.Key), in.IfNoneMatch); err != nil {
+		return nil, err
+	}
+	parts := f.uploads[aws.ToString(in.UploadId)]
+	var body []byte
+	etags := md5.New()
+	for idx, part := range in.MultipartUpload.Parts {
+		if aws.ToInt32(part.PartNumber) != int32(idx+1) {
+			return nil, fmt.Errorf("unexpected part %d", aws.ToInt32(part.PartNumber))
+		}
+		partBody := parts[aws.ToInt32(part.PartNumber)]
+		sum := md5.Sum(partBody)
+		etags.Write(sum[:])
+		body = append(body, partBody...)
+	}
+	f.objects[aws.ToString(in.Bucket)+"/"+aws.ToString(in.Key)] = body
+	delete(f.uploads, aws.ToString(in.UploadId))
+	etag := fmt.Sprintf(`"%x-%d"`, etags.Sum(nil), len(in.MultipartUpload.Parts))
+	return &s3.CompleteMultipartUploadOutput{ETag: aws.String(etag)}, nil
+}
+
+func (f *fakeS3) AbortMultipartUpload(ctx context.Context, in *s3.AbortMultipartUploadInput, _ ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.aborted = append(f.aborted, aws.ToString(in.UploadId))
+	delete(f.uploads, aws.ToString(in.UploadId))
+	return &s3.AbortMultipartUploadOutput{}, nil
+}
+
+func TestUploadWithInjectedClient(t *testing.T) {
+	fake := newFakeS3()
+	u := NewUploader("bucket", "eu-central-1", WithClient(fake))
+
+	for _, key := range []string{"a.pdf", "b.pdf"} {
+		if err := u.Upload(context.Background(), key, []byte("content of "+key)); err != nil {
+			t.Fatalf("upload failed: %v", err)
+		}
+	}
+	if got := string(fake.objects["bucket/b.pdf"]); got != "content of b.pdf" {
+		t.Errorf("unexpected object content: %q", got)
+	}
+}
+
+func TestUploadIntegrity(t *testing.T) {
+	fake := newFakeS3()
+	u := NewUploader("bucket", "eu-central-1", WithClient(fake))
+	ctx := context.Background()
+	data := bytes.Repeat([]byte("x"), int(MinPartSize)+1)
+
+	if err := u.UploadWithOptions(ctx, "once", []byte("first"), &UploadOptions{IfNotExists: true}); err != nil {
+		t.Fatalf("upload failed: %v", err)
+	}
+	err := u.UploadWithOptions(ctx, "once", []byte("second"), &UploadOptions{IfNotExists: true})
+	if !errors.Is(err, ErrExists) {
+		t.Errorf("expected ErrExists, got %v", err)
+	}
+	err = u.UploadStream(ctx, "once", bytes.NewReader(data), &StreamOptions{UploadOptions: UploadOptions{IfNotExists: true}})
+	if !errors.Is(err, ErrExists) {
+		t.Errorf("expected ErrExists for stream, got %v", err)
+	}
+	if string(fake.objects["bucket/once"]) != "first" {
+		t.Errorf("object was replaced")
+	}
+
+	fake.corrupt = true
+	if err := u.Upload(ctx, "corrupt", []byte("data")); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("expected ErrChecksumMismatch, got %v", err)
+	}
+	if err := u.UploadStream(ctx, "corrupt", bytes.NewReader(data), nil); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("expected ErrChecksumMismatch for stream, got %v", err)
+	}
+	if err := u.Upload(ctx, "corrupt", data); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("expected ErrChecksumMismatch for multipart upload, got %v", err)
+	}
+
+	fake.corrupt = false
+	if err := u.Upload(ctx, "large", data); err != nil {
+		t.Errorf("multipart upload failed: %v", err)
+	}
+
+	// the transfer manager puts data of exactly one part in one request
+	exact := data[:MinPartSize]
+	if err := u.UploadWithOptions(ctx, "exact", exact, &UploadOptions{IfNotExists: true}); err != nil {
+		t.Errorf("upload of exactly one part failed: %v", err)
+	}
+	if !bytes.Equal(fake.objects["bucket/exact"], exact) {
+		t.Errorf("unexpected content of %d bytes", len(fake.objects["bucket/exact"]))
+	}
+}
+
+func TestDetectContentType(t *testing.T) {
+	for _, tc := range []struct {
+		key, contentType string
+		head             []byte
+		want             string
+	}{
+		{"report.pdf", "", nil, "application/pdf"},
+		{"report.pdf", "application/x-custom", nil, "application/x-custom"},
+		{"blob", "", []byte("%PDF-1.7"), "application/pdf"},
+		{"blob", "", []byte{0x00, 0x01}, "application/octet-stream"},
+	} {
+		if got := detectContentType(tc.key, tc.contentType, tc.head); got != tc.want {
+			t.Errorf("detectContentType(%q, %q) = %q, want %q", tc.key, tc.contentType, got, tc.want)
+		}
+	}
+}
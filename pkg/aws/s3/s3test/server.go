@@ -0,0 +1,479 @@
+// Package s3test provides an in-process S3 compatible server for tests
+// of code using the s3 package.
+package s3test
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Server is an in-process S3 compatible server for tests, e.g. run with
+// `httptest.NewTLSServer`. It serves a single bucket with path-style
+// addressing and supports the object, listing, copy and multipart calls
+// used by the Uploader.
+type Server struct {
+	bucket    string
+	accessKey string
+
+	mu      sync.Mutex
+	objects map[string]serverObject
+	uploads map[string]*serverUpload
+	nextID  int
+	calls   map[string]int
+}
+
+type serverObject struct {
+	data        []byte
+	etag        string
+	contentType string
+	metadata    http.Header
+	modified    time.Time
+	// customerKeyMD5 is set for objects encrypted with SSE-C.
+	customerKeyMD5 string
+}
+
+type serverUpload struct {
+	key         string
+	contentType string
+	metadata    http.Header
+	parts       map[int][]byte
+	// customerKeyMD5 is set for uploads encrypted with SSE-C, which then
+	// require the key on every part and on completion.
+	customerKeyMD5 string
+}
+
+// NewServer returns a server for `bucket` accepting requests signed
+// with `accessKey` and any secret.
+func NewServer(bucket, accessKey string) *Server {
+	return &Server{
+		bucket:    bucket,
+		accessKey: accessKey,
+		objects:   map[string]serverObject{},
+		uploads:   map[string]*serverUpload{},
+		calls:     map[string]int{},
+	}
+}
+
+// Calls returns the number of requests served for `operation`, named
+// like the S3 API call, e.g. "PutObject".
+func (s *Server) Calls(operation string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[operation]
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	credential := r.URL.Query().Get("X-Amz-Credential")
+	if credential == "" {
+		_, credential, _ = strings.Cut(r.Header.Get("Authorization"), "Credential=")
+	}
+	if !strings.HasPrefix(credential, s.accessKey+"/") {
+		s.error(w, r, http.StatusForbidden, "InvalidAccessKeyId", "unknown access key")
+		return
+	}
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != s.bucket {
+		s.error(w, r, http.StatusNotFound, "NoSuchBucket", "no such bucket")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	query := r.URL.Query()
+	op := operation(r, key, query)
+	s.calls[op]++
+	switch op {
+	case "ListObjectsV2":
+		s.list(w, query.Get("prefix"))
+	case "DeleteObjects":
+		s.deleteObjects(w, r)
+	case "CreateMultipartUpload":
+		s.createUpload(w, r, key)
+	case "UploadPart":
+		s.uploadPart(w, r, query)
+	case "CompleteMultipartUpload":
+		s.completeUpload(w, r, key, query.Get("uploadId"))
+	case "AbortMultipartUpload":
+		delete(s.uploads, query.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+	case "CopyObject":
+		s.copyObject(w, r, key)
+	case "PutObject":
+		s.putObject(w, r, key)
+	case "GetObject", "HeadObject":
+		s.getObject(w, r, key)
+	case "DeleteObject":
+		delete(s.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		s.error(w, r, http.StatusNotImplemented, "NotImplemented", r.Method+" "+r.URL.String())
+	}
+}
+
+// operation names the S3 API call of a request, or returns "" for calls
+// not supported.
+func operation(r *http.Request, key string, query url.Values) string {
+	switch {
+	case key == "" && r.Method == http.MethodGet:
+		return "ListObjectsV2"
+	case key == "" && r.Method == http.MethodPost && query.Has("delete"):
+		return "DeleteObjects"
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		return "CreateMultipartUpload"
+	case r.Method == http.MethodPut && query.Has("partNumber"):
+		return "UploadPart"
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		return "CompleteMultipartUpload"
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		return "AbortMultipartUpload"
+	case r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") != "":
+		return "CopyObject"
+	case r.Method == http.MethodPut:
+		return "PutObject"
+	case r.Method == http.MethodGet:
+		return "GetObject"
+	case r.Method == http.MethodHead:
+		return "HeadObject"
+	case r.Method == http.MethodDelete:
+		return "DeleteObject"
+	}
+	return ""
+}
+
+func (s *Server) error(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	if r.Method != http.MethodHead {
+		fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, message)
+	}
+}
+
+func (s *Server) xml(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/xml")
+	_ = xml.NewEncoder(w).Encode(v)
+}
+
+// body reads the request body, decoding the aws-chunked encoding the SDK
+// uses to send trailing checksums, and verifies the Content-MD5.
+func (s *Server) body(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	var (
+		data []byte
+		err  error
+	)
+	if strings.Contains(r.Header.Get("Content-Encoding"), "aws-chunked") ||
+		strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		data, err = decodeChunked(r.Body)
+	} else {
+		data, err = io.ReadAll(r.Body)
+	}
+	if err != nil {
+		s.error(w, r, http.StatusBadRequest, "IncompleteBody", err.Error())
+		return nil, false
+	}
+	if contentMD5 := r.Header.Get("Content-Md5"); contentMD5 != "" {
+		sum := md5.Sum(data)
+		if contentMD5 != base64.StdEncoding.EncodeToString(sum[:]) {
+			s.error(w, r, http.StatusBadRequest, "BadDigest", "content md5 mismatch")
+			return nil, false
+		}
+	}
+	return data, true
+}
+
+func decodeChunked(r io.Reader) ([]byte, error) {
+	br := bufio.NewReader(r)
+	var data []byte
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, _, _ := strings.Cut(strings.TrimSpace(line), ";")
+		n, err := strconv.ParseInt(size, 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid chunk size %q", size)
+		}
+		if n == 0 {
+			// trailing checksums follow, which are not verified
+			return data, nil
+		}
+		chunk := make([]byte, n)
+		if _, err := io.ReadFull(br, chunk); err != nil {
+			return nil, err
+		}
+		data = append(data, chunk...)
+		if _, err := br.ReadString('\n'); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func userMetadata(h http.Header) http.Header {
+	metadata := http.Header{}
+	for k, v := range h {
+		if strings.HasPrefix(k, "X-Amz-Meta-") {
+			metadata[k] = v
+		}
+	}
+	return metadata
+}
+
+func (s *Server) store(key string, data []byte, etag, contentType string, metadata http.Header, customerKeyMD5 string) serverObject {
+	obj := serverObject{data: data, etag: etag, contentType: contentType, metadata: metadata, modified: time.Now().UTC(), customerKeyMD5: customerKeyMD5}
+	s.objects[key] = obj
+	return obj
+}
+
+const (
+	headerCustomerKeyMD5           = "X-Amz-Server-Side-Encryption-Customer-Key-Md5"
+	headerCopySourceCustomerKeyMD5 = "X-Amz-Copy-Source-Server-Side-Encryption-Customer-Key-Md5"
+)
+
+// customerKey checks that the SSE-C key of the request in `header`
+// matches the one the content is encrypted with, if any.
+func (s *Server) customerKey(w http.ResponseWriter, r *http.Request, header, expected string) bool {
+	if r.Header.Get(header) != expected {
+		s.error(w, r, http.StatusBadRequest, "InvalidRequest", "SSE-C key missing or wrong")
+		return false
+	}
+	return true
+}
+
+func (s *Server) exists(w http.ResponseWriter, r *http.Request, key string) bool {
+	if _, ok := s.objects[key]; ok && r.Header.Get("If-None-Match") == "*" {
+		s.error(w, r, http.StatusPreconditionFailed, "PreconditionFailed", "object exists")
+		return true
+	}
+	return false
+}
+
+func (s *Server) putObject(w http.ResponseWriter, r *http.Request, key string) {
+	data, ok := s.body(w, r)
+	if !ok || s.exists(w, r, key) {
+		return
+	}
+	sum := md5.Sum(data)
+	obj := s.store(key, data, hex.EncodeToString(sum[:]), r.Header.Get("Content-Type"), userMetadata(r.Header), r.Header.Get(headerCustomerKeyMD5))
+	w.Header().Set("ETag", `"`+obj.etag+`"`)
+	setChecksum(w, data)
+}
+
+func setChecksum(w http.ResponseWriter, data []byte) {
+	sum := sha256.Sum256(data)
+	w.Header().Set("X-Amz-Checksum-Sha256", base64.StdEncoding.EncodeToString(sum[:]))
+}
+
+func (s *Server) getObject(w http.ResponseWriter, r *http.Request, key string) {
+	obj, ok := s.objects[key]
+	if !ok {
+		s.error(w, r, http.StatusNotFound, "NoSuchKey", "no such key")
+		return
+	}
+	if !s.customerKey(w, r, headerCustomerKeyMD5, obj.customerKeyMD5) {
+		return
+	}
+	for k, v := range obj.metadata {
+		w.Header()[k] = v
+	}
+	w.Header().Set("ETag", `"`+obj.etag+`"`)
+	w.Header().Set("Content-Type", obj.contentType)
+	w.Header().Set("Last-Modified", obj.modified.Format(http.TimeFormat))
+	w.Header().Set("Accept-Ranges", "bytes")
+
+	data, status := obj.data, http.StatusOK
+	if byteRange := r.Header.Get("Range"); byteRange != "" {
+		var first, last int
+		if _, err := fmt.Sscanf(byteRange, "bytes=%d-%d", &first, &last); err != nil || first > last || first >= len(data) {
+			s.error(w, r, http.StatusRequestedRangeNotSatisfiable, "InvalidRange", byteRange)
+			return
+		}
+		last = min(last, len(data)-1)
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", first, last, len(data)))
+		data, status = data[first:last+1], http.StatusPartialContent
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.WriteHeader(status)
+	if r.Method == http.MethodGet {
+		_, _ = w.Write(data)
+	}
+}
+
+type listContents struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int    `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+// list returns all objects below `prefix` on a single page.
+func (s *Server) list(w http.ResponseWriter, prefix string) {
+	result := struct {
+		XMLName     xml.Name       `xml:"ListBucketResult"`
+		Name        string         `xml:"Name"`
+		Prefix      string         `xml:"Prefix"`
+		KeyCount    int            `xml:"KeyCount"`
+		IsTruncated bool           `xml:"IsTruncated"`
+		Contents    []listContents `xml:"Contents"`
+	}{Name: s.bucket, Prefix: prefix}
+	for key, obj := range s.objects {
+		if strings.HasPrefix(key, prefix) {
+			result.Contents = append(result.Contents, listContents{
+				Key:          key,
+				LastModified: obj.modified.Format("2006-01-02T15:04:05.000Z"),
+				ETag:         `"` + obj.etag + `"`,
+				Size:         len(obj.data),
+				StorageClass: "STANDARD",
+			})
+		}
+	}
+	sort.Slice(result.Contents, func(i, j int) bool { return result.Contents[i].Key < result.Contents[j].Key })
+	result.KeyCount = len(result.Contents)
+	s.xml(w, result)
+}
+
+func (s *Server) deleteObjects(w http.ResponseWriter, r *http.Request) {
+	data, ok := s.body(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Objects []struct {
+			Key string `xml:"Key"`
+		} `xml:"Object"`
+	}
+	if err := xml.Unmarshal(data, &req); err != nil {
+		s.error(w, r, http.StatusBadRequest, "MalformedXML", err.Error())
+		return
+	}
+	for _, obj := range req.Objects {
+		delete(s.objects, obj.Key)
+	}
+	s.xml(w, struct {
+		XMLName xml.Name `xml:"DeleteResult"`
+	}{})
+}
+
+func (s *Server) copyObject(w http.ResponseWriter, r *http.Request, key string) {
+	source, err := url.PathUnescape(strings.TrimPrefix(r.Header.Get("X-Amz-Copy-Source"), "/"))
+	if err != nil {
+		s.error(w, r, http.StatusBadRequest, "InvalidArgument", err.Error())
+		return
+	}
+	bucket, srcKey, _ := strings.Cut(source, "/")
+	obj, ok := s.objects[srcKey]
+	if bucket != s.bucket || !ok {
+		s.error(w, r, http.StatusNotFound, "NoSuchKey", "no such key")
+		return
+	}
+	if !s.customerKey(w, r, headerCopySourceCustomerKeyMD5, obj.customerKeyMD5) {
+		return
+	}
+	if r.Header.Get("X-Amz-Metadata-Directive") == "REPLACE" {
+		obj.contentType, obj.metadata = r.Header.Get("Content-Type"), userMetadata(r.Header)
+	}
+	obj = s.store(key, obj.data, obj.etag, obj.contentType, obj.metadata, r.Header.Get(headerCustomerKeyMD5))
+	s.xml(w, struct {
+		XMLName      xml.Name `xml:"CopyObjectResult"`
+		ETag         string   `xml:"ETag"`
+		LastModified string   `xml:"LastModified"`
+	}{ETag: `"` + obj.etag + `"`, LastModified: obj.modified.Format("2006-01-02T15:04:05.000Z")})
+}
+
+func (s *Server) createUpload(w http.ResponseWriter, r *http.Request, key string) {
+	s.nextID++
+	id := strconv.Itoa(s.nextID)
+	s.uploads[id] = &serverUpload{
+		key:            key,
+		contentType:    r.Header.Get("Content-Type"),
+		metadata:       userMetadata(r.Header),
+		parts:          map[int][]byte{},
+		customerKeyMD5: r.Header.Get(headerCustomerKeyMD5),
+	}
+	s.xml(w, struct {
+		XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+		Bucket   string   `xml:"Bucket"`
+		Key      string   `xml:"Key"`
+		UploadID string   `xml:"UploadId"`
+	}{Bucket: s.bucket, Key: key, UploadID: id})
+}
+
+func (s *Server) uploadPart(w http.ResponseWriter, r *http.Request, query url.Values) {
+	upload, ok := s.uploads[query.Get("uploadId")]
+	if !ok {
+		s.error(w, r, http.StatusNotFound, "NoSuchUpload", "no such upload")
+		return
+	}
+	if !s.customerKey(w, r, headerCustomerKeyMD5, upload.customerKeyMD5) {
+		return
+	}
+	number, err := strconv.Atoi(query.Get("partNumber"))
+	if err != nil {
+		s.error(w, r, http.StatusBadRequest, "InvalidArgument", err.Error())
+		return
+	}
+	data, ok := s.body(w, r)
+	if !ok {
+		return
+	}
+	upload.parts[number] = data
+	w.Header().Set("ETag", fmt.Sprintf(`"%x"`, md5.Sum(data)))
+	setChecksum(w, data)
+}
+
+func (s *Server) completeUpload(w http.ResponseWriter, r *http.Request, key, id string) {
+	upload, ok := s.uploads[id]
+	if !ok {
+		s.error(w, r, http.StatusNotFound, "NoSuchUpload", "no such upload")
+		return
+	}
+	if !s.customerKey(w, r, headerCustomerKeyMD5, upload.customerKeyMD5) {
+		return
+	}
+	body, ok := s.body(w, r)
+	if !ok || s.exists(w, r, key) {
+		return
+	}
+	var req struct {
+		Parts []struct {
+			PartNumber int `xml:"PartNumber"`
+		} `xml:"Part"`
+	}
+	if err := xml.Unmarshal(body, &req); err != nil {
+		s.error(w, r, http.StatusBadRequest, "MalformedXML", err.Error())
+		return
+	}
+	var data []byte
+	sums := md5.New()
+	for _, part := range req.Parts {
+		content, ok := upload.parts[part.PartNumber]
+		if !ok {
+			s.error(w, r, http.StatusBadRequest, "InvalidPart", strconv.Itoa(part.PartNumber))
+			return
+		}
+		sum := md5.Sum(content)
+		sums.Write(sum[:])
+		data = append(data, content...)
+	}
+	delete(s.uploads, id)
+	obj := s.store(key, data, fmt.Sprintf("%x-%d", sums.Sum(nil), len(req.Parts)), upload.contentType, upload.metadata, upload.customerKeyMD5)
+	s.xml(w, struct {
+		XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+		Bucket  string   `xml:"Bucket"`
+		Key     string   `xml:"Key"`
+		ETag    string   `xml:"ETag"`
+	}{Bucket: s.bucket, Key: key, ETag: `"` + obj.etag + `"`})
+}
@@ -0,0 +1,296 @@
+package s3
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/paraopsde/go-x/pkg/util"
+	"go.uber.org/zap"
+)
+
+// metaSHA256 records the hex encoded SHA-256 of synced files.
+const metaSHA256 = "Go-X-Sha256"
+
+// SyncOptions configure `Sync`.
+type SyncOptions struct {
+	// Region of the bucket; the default AWS configuration applies if
+	// empty.
+	Region string
+	// UploaderOptions configure the Uploader used by `Sync`.
+	UploaderOptions []Option
+	// Delete removes objects below the prefix that have no local file.
+	Delete bool
+	// DryRun only reports what would be done.
+	DryRun bool
+	// Concurrency is the number of files transferred in parallel.
+	Concurrency int
+	// Output receives a line per upload, deletion and skipped entry, e.g.
+	// to show what a dry run would do.
+	Output io.Writer
+}
+
+// SyncResult lists the keys touched by a sync, or that would be touched
+// by a dry run.
+type SyncResult struct {
+	Uploaded  []string
+	Deleted   []string
+	Unchanged int
+	// Skipped lists the keys of local entries that are neither files nor
+	// symbolic links to files, e.g. linked directories or sockets.
+	// Objects below them are not deleted.
+	Skipped []string
+}
+
+// Sync makes the objects below `target`, an URL like
+// "s3://bucket/prefix", match the files below `localDir`. See
+// `Uploader.Sync`.
+func Sync(ctx context.Context, localDir, target string, opts *SyncOptions) (*SyncResult, error) {
+	if opts == nil {
+		opts = &SyncOptions{}
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse sync target: %w", err)
+	}
+	if u.Scheme != "s3" || u.Host == "" {
+		return nil, fmt.Errorf("sync target %s is no s3://bucket/prefix url", target)
+	}
+	uploader := NewUploader(u.Host, opts.Region, opts.UploaderOptions...)
+	return uploader.Sync(ctx, localDir, strings.TrimPrefix(u.Path, "/"), opts)
+}
+
+// Sync uploads the files below `localDir` to `prefix` that are missing or
+// differ in size or checksum, and deletes orphaned objects if requested.
+// Failing files do not stop the sync; all errors are returned joined.
+//
+// Checksums are compared by the ETag of objects uploaded in a single
+// part, otherwise by the SHA-256 recorded in the metadata by earlier
+// syncs. Symbolic links to files are synced with the content of the file;
+// other entries that are no regular files are skipped and reported.
+func (u *Uploader) Sync(ctx context.Context, localDir, prefix string, opts *SyncOptions) (*SyncResult, error) {
+	if opts == nil {
+		opts = &SyncOptions{}
+	}
+	log, ctx := util.CtxLogOrInjectNew(ctx)
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultConcurrency
+	}
+
+	remote := map[string]ObjectInfo{}
+	for obj, err := range u.List(ctx, prefix) {
+		if err != nil {
+			return nil, err
+		}
+		remote[obj.Key] = obj
+	}
+
+	var (
+		files   []string
+		skipped = map[string]string{}
+	)
+	err := filepath.WalkDir(localDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if d.Type().IsRegular() {
+			files = append(files, path)
+			return nil
+		}
+		reason := "no regular file"
+		if d.Type()&fs.ModeSymlink != 0 {
+			fi, err := os.Stat(path)
+			switch {
+			case err != nil:
+				reason = "broken link"
+			case fi.Mode().IsRegular():
+				files = append(files, path)
+				return nil
+			case fi.IsDir():
+				reason = "linked directory"
+			}
+		}
+		rel, err := filepath.Rel(localDir, path)
+		if err != nil {
+			return err
+		}
+		skipped[prefix+filepath.ToSlash(rel)] = reason
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk %s: %w", localDir, err)
+	}
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		errs    []error
+		result  = &SyncResult{}
+		reasons = map[string]string{}
+		sem     = make(chan struct{}, concurrency)
+	)
+	report := func(format string, args ...interface{}) {
+		if opts.Output != nil {
+			mu.Lock()
+			fmt.Fprintf(opts.Output, format+"\n", args...)
+			mu.Unlock()
+		}
+	}
+	for key, reason := range skipped {
+		result.Skipped = append(result.Skipped, key)
+		for remoteKey := range remote {
+			if remoteKey == key || strings.HasPrefix(remoteKey, key+"/") {
+				delete(remote, remoteKey)
+			}
+		}
+		log.Warn("Skipping sync of entry.", zap.String("key", key), zap.String("reason", reason))
+	}
+	sort.Strings(result.Skipped)
+	for _, key := range result.Skipped {
+		report("skip %s (%s)", key, skipped[key])
+	}
+
+	for _, path := range files {
+		rel, err := filepath.Rel(localDir, path)
+		if err != nil {
+			return nil, err
+		}
+		key := prefix + filepath.ToSlash(rel)
+		obj, exists := remote[key]
+		delete(remote, key)
+
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			reason, err := u.syncFile(ctx, path, key, obj, exists, opts.DryRun)
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err != nil:
+				errs = append(errs, err)
+			case reason == "":
+				result.Unchanged++
+			default:
+				result.Uploaded = append(result.Uploaded, key)
+				reasons[key] = reason
+			}
+		}()
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	wg.Wait()
+	sort.Strings(result.Uploaded)
+	for _, key := range result.Uploaded {
+		report("upload %s (%s)", key, reasons[key])
+	}
+
+	if opts.Delete && ctx.Err() == nil {
+		for key := range remote {
+			result.Deleted = append(result.Deleted, key)
+		}
+		sort.Strings(result.Deleted)
+		for _, key := range result.Deleted {
+			report("delete %s", key)
+		}
+		if !opts.DryRun {
+			if err := u.DeleteMany(ctx, result.Deleted); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		errs = append(errs, err)
+	}
+	return result, errors.Join(errs...)
+}
+
+// syncFile uploads `path` to `key` unless the object `obj` matches it,
+// returning why it was uploaded.
+func (u *Uploader) syncFile(ctx context.Context, path, key string, obj ObjectInfo, exists, dryRun bool) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return "", fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+
+	md5sum, sha256sum := md5.New(), sha256.New()
+	if _, err := io.Copy(io.MultiWriter(md5sum, sha256sum), f); err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	localMD5 := hex.EncodeToString(md5sum.Sum(nil))
+	localSHA256 := hex.EncodeToString(sha256sum.Sum(nil))
+
+	reason, err := u.syncReason(ctx, key, obj, exists, fi.Size(), localMD5, localSHA256)
+	if err != nil || reason == "" || dryRun {
+		return reason, err
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", fmt.Errorf("failed to rewind %s: %w", path, err)
+	}
+	metadata := map[string]string{metaSHA256: localSHA256}
+	if fi.Size() < DefaultPartSize {
+		data, err := io.ReadAll(f)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		err = u.UploadWithOptions(ctx, key, data, &UploadOptions{Metadata: metadata})
+		return reason, err
+	}
+	err = u.UploadStream(ctx, key, f, &StreamOptions{UploadOptions: UploadOptions{Metadata: metadata}, Concurrency: 1})
+	return reason, err
+}
+
+// syncReason returns why a file needs to be uploaded or "" if the object
+// stored matches it.
+func (u *Uploader) syncReason(ctx context.Context, key string, obj ObjectInfo, exists bool, size int64, localMD5, localSHA256 string) (string, error) {
+	if !exists {
+		return "new", nil
+	}
+	// sealed objects differ in size and ETag from their content
+	if !u.opts.clientSide() {
+		if obj.Size != size {
+			return "size", nil
+		}
+		etag := strings.Trim(obj.ETag, `"`)
+		if u.opts.etagIsMD5() && !strings.Contains(etag, "-") {
+			if etag != localMD5 {
+				return "checksum", nil
+			}
+			return "", nil
+		}
+	}
+	info, err := u.Head(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	if metadataValue(info.Metadata, metaSHA256) != localSHA256 {
+		return "checksum", nil
+	}
+	return "", nil
+}
@@ -0,0 +1,110 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSync(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{"a.txt": "a", "sub/b.txt": "b", "sub/c.txt": "c"} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fake := newFakeS3()
+	fake.objects["bucket/site/sub/b.txt"] = []byte("b")
+	fake.objects["bucket/site/sub/c.txt"] = []byte("x")
+	fake.objects["bucket/site/orphan.txt"] = []byte("o")
+	ctx := context.Background()
+
+	var out bytes.Buffer
+	opts := &SyncOptions{UploaderOptions: []Option{WithClient(fake)}, Delete: true, DryRun: true, Output: &out}
+	result, err := Sync(ctx, dir, "s3://bucket/site", opts)
+	if err != nil {
+		t.Fatalf("dry run failed: %v", err)
+	}
+	want := "upload site/a.txt (new)\nupload site/sub/c.txt (checksum)\ndelete site/orphan.txt\n"
+	if out.String() != want {
+		t.Errorf("unexpected dry run output:\n%s", out.String())
+	}
+	if string(fake.objects["bucket/site/sub/c.txt"]) != "x" || fake.objects["bucket/site/orphan.txt"] == nil {
+		t.Errorf("dry run changed objects")
+	}
+
+	opts.DryRun = false
+	result, err = Sync(ctx, dir, "s3://bucket/site", opts)
+	if err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	if strings.Join(result.Uploaded, ",") != "site/a.txt,site/sub/c.txt" || result.Unchanged != 1 || len(result.Deleted) != 1 {
+		t.Errorf("unexpected result %+v", result)
+	}
+	if string(fake.objects["bucket/site/sub/c.txt"]) != "c" || fake.objects["bucket/site/orphan.txt"] != nil {
+		t.Errorf("objects not synced")
+	}
+
+	result, err = Sync(ctx, dir, "s3://bucket/site", opts)
+	if err != nil || len(result.Uploaded) != 0 || result.Unchanged != 3 {
+		t.Errorf("second sync not idempotent: %+v, %v", result, err)
+	}
+}
+
+func TestSyncExactPartSize(t *testing.T) {
+	dir := t.TempDir()
+	data := bytes.Repeat([]byte("x"), int(MinPartSize))
+	if err := os.WriteFile(filepath.Join(dir, "part.bin"), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fake := newFakeS3()
+	result, err := Sync(context.Background(), dir, "s3://bucket/site", &SyncOptions{UploaderOptions: []Option{WithClient(fake)}})
+	if err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	if len(result.Uploaded) != 1 || !bytes.Equal(fake.objects["bucket/site/part.bin"], data) {
+		t.Errorf("unexpected result %+v", result)
+	}
+}
+
+func TestSyncSymlinks(t *testing.T) {
+	dir, other := t.TempDir(), t.TempDir()
+	if err := os.WriteFile(filepath.Join(other, "real.txt"), []byte("real"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for link, target := range map[string]string{
+		"file.txt": filepath.Join(other, "real.txt"),
+		"dir":      other,
+		"broken":   filepath.Join(other, "missing"),
+	} {
+		if err := os.Symlink(target, filepath.Join(dir, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fake := newFakeS3()
+	fake.objects["bucket/site/dir/real.txt"] = []byte("real")
+	fake.objects["bucket/site/orphan.txt"] = []byte("o")
+
+	var out bytes.Buffer
+	opts := &SyncOptions{UploaderOptions: []Option{WithClient(fake)}, Delete: true, Output: &out}
+	result, err := Sync(context.Background(), dir, "s3://bucket/site", opts)
+	if err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	if strings.Join(result.Uploaded, ",") != "site/file.txt" || string(fake.objects["bucket/site/file.txt"]) != "real" {
+		t.Errorf("linked file not synced: %+v", result)
+	}
+	if strings.Join(result.Skipped, ",") != "site/broken,site/dir" || !strings.Contains(out.String(), "skip site/dir (linked directory)\n") {
+		t.Errorf("unexpected skipped entries %v, output:\n%s", result.Skipped, out.String())
+	}
+	if strings.Join(result.Deleted, ",") != "site/orphan.txt" || fake.objects["bucket/site/dir/real.txt"] == nil {
+		t.Errorf("objects below skipped entries deleted: %v", result.Deleted)
+	}
+}
@@ -0,0 +1,195 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// ObjectVersion describes a version of an object in a versioned bucket,
+// or a delete marker hiding older versions.
+type ObjectVersion struct {
+	Key          string
+	VersionID    string
+	Size         int64
+	ETag         string
+	LastModified time.Time
+	IsLatest     bool
+	DeleteMarker bool
+}
+
+// ListVersions iterates over all versions and delete markers of the
+// objects whose key starts with `prefix`. Within a page, versions are
+// ordered by key, newest first. Iteration stops after the first error.
+func (u *Uploader) ListVersions(ctx context.Context, prefix string) iter.Seq2[ObjectVersion, error] {
+	return func(yield func(ObjectVersion, error) bool) {
+		s3Client, err := u.s3Client()
+		if err != nil {
+			yield(ObjectVersion{}, err)
+			return
+		}
+		in := &s3.ListObjectVersionsInput{
+			Bucket: aws.String(u.bucket),
+			Prefix: aws.String(prefix),
+		}
+		for {
+			out, err := s3Client.ListObjectVersions(ctx, in)
+			if err != nil {
+				yield(ObjectVersion{}, fmt.Errorf("failed to list versions of %s: %w", prefix, err))
+				return
+			}
+			versions := make([]ObjectVersion, 0, len(out.Versions)+len(out.DeleteMarkers))
+			for _, v := range out.Versions {
+				versions = append(versions, ObjectVersion{
+					Key:          aws.ToString(v.Key),
+					VersionID:    aws.ToString(v.VersionId),
+					Size:         aws.ToInt64(v.Size),
+					ETag:         aws.ToString(v.ETag),
+					LastModified: aws.ToTime(v.LastModified),
+					IsLatest:     aws.ToBool(v.IsLatest),
+				})
+			}
+			for _, m := range out.DeleteMarkers {
+				versions = append(versions, ObjectVersion{
+					Key:          aws.ToString(m.Key),
+					VersionID:    aws.ToString(m.VersionId),
+					LastModified: aws.ToTime(m.LastModified),
+					IsLatest:     aws.ToBool(m.IsLatest),
+					DeleteMarker: true,
+				})
+			}
+			sort.SliceStable(versions, func(i, j int) bool {
+				if versions[i].Key != versions[j].Key {
+					return versions[i].Key < versions[j].Key
+				}
+				return versions[i].LastModified.After(versions[j].LastModified)
+			})
+			for _, v := range versions {
+				if !yield(v, nil) {
+					return
+				}
+			}
+			if !aws.ToBool(out.IsTruncated) {
+				return
+			}
+			in.KeyMarker = out.NextKeyMarker
+			in.VersionIdMarker = out.NextVersionIdMarker
+		}
+	}
+}
+
+// DownloadVersion returns the content of version `versionID` of `key`.
+// The caller must close the returned reader.
+func (u *Uploader) DownloadVersion(ctx context.Context, key, versionID string) (io.ReadCloser, error) {
+	if versionID == "" {
+		return nil, fmt.Errorf("missing version of %s", key)
+	}
+	return u.download(ctx, key, "", versionID)
+}
+
+// RestoreVersion makes version `versionID` of `key` the current one by
+// copying it, so the versions in between are kept.
+func (u *Uploader) RestoreVersion(ctx context.Context, key, versionID string) error {
+	s3Client, err := u.s3Client()
+	if err != nil {
+		return err
+	}
+	in := &s3.CopyObjectInput{
+		Bucket:     aws.String(u.bucket),
+		Key:        aws.String(key),
+		CopySource: aws.String(copySource(u.bucket, key, versionID)),
+	}
+	in.ServerSideEncryption, in.SSEKMSKeyId = u.opts.serverSide()
+	in.SSECustomerAlgorithm, in.SSECustomerKey, in.SSECustomerKeyMD5 = u.opts.customerKey()
+	in.CopySourceSSECustomerAlgorithm, in.CopySourceSSECustomerKey, in.CopySourceSSECustomerKeyMD5 = u.opts.customerKey()
+	_, err = s3Client.CopyObject(ctx, in)
+	if err != nil {
+		return fmt.Errorf("failed to restore version %s of %s: %w", versionID, key, notFound(err))
+	}
+	return nil
+}
+
+// DeleteVersion permanently deletes version `versionID` of `key`.
+// Deleting a delete marker makes the version before it current again.
+func (u *Uploader) DeleteVersion(ctx context.Context, key, versionID string) error {
+	return u.DeleteVersions(ctx, []ObjectVersion{{Key: key, VersionID: versionID}})
+}
+
+// DeleteVersions permanently deletes `versions`, batching requests as
+// needed. Nothing is deleted if an entry lacks its version. All versions
+// are attempted, even if a batch fails; the error lists those that
+// failed, e.g. due to an object lock, and the batches S3 rejected.
+func (u *Uploader) DeleteVersions(ctx context.Context, versions []ObjectVersion) error {
+	_, err := u.deleteVersions(ctx, versions)
+	return err
+}
+
+// deleteVersions implements `DeleteVersions`, returning the number of
+// versions deleted.
+func (u *Uploader) deleteVersions(ctx context.Context, versions []ObjectVersion) (int, error) {
+	for _, v := range versions {
+		if v.VersionID == "" {
+			return 0, fmt.Errorf("missing version of %s", v.Key)
+		}
+	}
+	s3Client, err := u.s3Client()
+	if err != nil {
+		return 0, err
+	}
+	var (
+		deleted int
+		errs    []error
+		failed  []string
+	)
+	for start := 0; start < len(versions); start += maxDeleteBatch {
+		batch := versions[start:min(start+maxDeleteBatch, len(versions))]
+		objects := make([]types.ObjectIdentifier, 0, len(batch))
+		for _, v := range batch {
+			objects = append(objects, types.ObjectIdentifier{Key: aws.String(v.Key), VersionId: aws.String(v.VersionID)})
+		}
+		out, err := s3Client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(u.bucket),
+			Delete: &types.Delete{Objects: objects, Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to delete %d versions from %s: %w", len(batch), batch[0].Key, err))
+			continue
+		}
+		deleted += len(batch) - len(out.Errors)
+		for _, e := range out.Errors {
+			failed = append(failed, fmt.Sprintf("%s@%s (%s)", aws.ToString(e.Key), aws.ToString(e.VersionId), aws.ToString(e.Code)))
+		}
+	}
+	if len(failed) > 0 {
+		errs = append(errs, fmt.Errorf("failed to delete %d versions: %s", len(failed), strings.Join(failed, ", ")))
+	}
+	return deleted, errors.Join(errs...)
+}
+
+// Purge permanently deletes all versions and delete markers of the
+// objects whose key starts with `prefix`, e.g. to erase the data of a
+// user. Note that "user/1" also matches "user/10"; end prefixes with a
+// "/" to purge a folder. It returns the number of versions deleted, also
+// if some of them failed.
+func (u *Uploader) Purge(ctx context.Context, prefix string) (int, error) {
+	if prefix == "" {
+		return 0, fmt.Errorf("refusing to purge the whole bucket %s", u.bucket)
+	}
+	var versions []ObjectVersion
+	for v, err := range u.ListVersions(ctx, prefix) {
+		if err != nil {
+			return 0, err
+		}
+		versions = append(versions, v)
+	}
+	return u.deleteVersions(ctx, versions)
+}
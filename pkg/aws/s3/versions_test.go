@@ -0,0 +1,236 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// versionedS3 fakes the version and lifecycle calls of a versioned
+// bucket, listing one version per page.
+type versionedS3 struct {
+	Client
+	mu       sync.Mutex
+	versions []ObjectVersion
+	copied   []string
+	rules    []types.LifecycleRule
+	deleted  bool
+	// deleteCalls counts the DeleteObjects calls
+	deleteCalls int
+}
+
+func (f *versionedS3) ListObjectVersions(ctx context.Context, in *s3.ListObjectVersionsInput, _ ...func(*s3.Options)) (*s3.ListObjectVersionsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := &s3.ListObjectVersionsOutput{}
+	for i, v := range f.versions {
+		if !strings.HasPrefix(v.Key, aws.ToString(in.Prefix)) ||
+			(in.VersionIdMarker != nil && v.VersionID <= *in.VersionIdMarker) {
+			continue
+		}
+		if v.DeleteMarker {
+			out.DeleteMarkers = append(out.DeleteMarkers, types.DeleteMarkerEntry{
+				Key: aws.String(v.Key), VersionId: aws.String(v.VersionID), LastModified: aws.Time(v.LastModified),
+			})
+		} else {
+			out.Versions = append(out.Versions, types.ObjectVersion{
+				Key: aws.String(v.Key), VersionId: aws.String(v.VersionID), LastModified: aws.Time(v.LastModified), Size: aws.Int64(v.Size),
+			})
+		}
+		if i < len(f.versions)-1 {
+			out.IsTruncated = aws.Bool(true)
+			out.NextKeyMarker = aws.String(v.Key)
+			out.NextVersionIdMarker = aws.String(v.VersionID)
+		}
+		break
+	}
+	return out, nil
+}
+
+func (f *versionedS3) DeleteObjects(ctx context.Context, in *s3.DeleteObjectsInput, _ ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.deleteCalls++
+	out := &s3.DeleteObjectsOutput{}
+	for _, obj := range in.Delete.Objects {
+		if aws.ToString(obj.Key) == "locked" {
+			out.Errors = append(out.Errors, types.Error{Key: obj.Key, VersionId: obj.VersionId, Code: aws.String("AccessDenied")})
+			continue
+		}
+		kept := f.versions[:0]
+		for _, v := range f.versions {
+			if v.Key != aws.ToString(obj.Key) || v.VersionID != aws.ToString(obj.VersionId) {
+				kept = append(kept, v)
+			}
+		}
+		f.versions = kept
+	}
+	return out, nil
+}
+
+func (f *versionedS3) CopyObject(ctx context.Context, in *s3.CopyObjectInput, _ ...func(*s3.Options)) (*s3.CopyObjectOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.copied = append(f.copied, aws.ToString(in.CopySource)+" -> "+aws.ToString(in.Key))
+	return &s3.CopyObjectOutput{}, nil
+}
+
+func (f *versionedS3) GetBucketLifecycleConfiguration(ctx context.Context, in *s3.GetBucketLifecycleConfigurationInput, _ ...func(*s3.Options)) (*s3.GetBucketLifecycleConfigurationOutput, error) {
+	if len(f.rules) == 0 {
+		return nil, &smithy.GenericAPIError{Code: "NoSuchLifecycleConfiguration"}
+	}
+	return &s3.GetBucketLifecycleConfigurationOutput{Rules: f.rules}, nil
+}
+
+func (f *versionedS3) PutBucketLifecycleConfiguration(ctx context.Context, in *s3.PutBucketLifecycleConfigurationInput, _ ...func(*s3.Options)) (*s3.PutBucketLifecycleConfigurationOutput, error) {
+	f.rules = in.LifecycleConfiguration.Rules
+	return &s3.PutBucketLifecycleConfigurationOutput{}, nil
+}
+
+func (f *versionedS3) DeleteBucketLifecycle(ctx context.Context, in *s3.DeleteBucketLifecycleInput, _ ...func(*s3.Options)) (*s3.DeleteBucketLifecycleOutput, error) {
+	f.rules, f.deleted = nil, true
+	return &s3.DeleteBucketLifecycleOutput{}, nil
+}
+
+func TestVersions(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	fake := &versionedS3{versions: []ObjectVersion{
+		{Key: "user/1/a", VersionID: "v1", LastModified: now.Add(-2 * time.Hour), Size: 1},
+		{Key: "user/1/a", VersionID: "v2", LastModified: now.Add(-time.Hour), Size: 2},
+		{Key: "user/1/a", VersionID: "v3", LastModified: now, DeleteMarker: true},
+		{Key: "user/2/b", VersionID: "v4", LastModified: now, Size: 4},
+	}}
+	u := NewUploader("bucket", "eu-central-1", WithClient(fake))
+
+	var listed []string
+	for v, err := range u.ListVersions(ctx, "user/1/") {
+		if err != nil {
+			t.Fatalf("list versions failed: %v", err)
+		}
+		listed = append(listed, v.VersionID)
+	}
+	if strings.Join(listed, ",") != "v1,v2,v3" {
+		t.Errorf("unexpected versions listed: %v", listed)
+	}
+
+	if err := u.RestoreVersion(ctx, "user/1/a", "v1"); err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+	if len(fake.copied) != 1 || !strings.HasSuffix(fake.copied[0], "?versionId=v1 -> user/1/a") {
+		t.Errorf("unexpected copy: %v", fake.copied)
+	}
+
+	if err := u.DeleteVersion(ctx, "user/2/b", "v4"); err != nil {
+		t.Fatalf("delete version failed: %v", err)
+	}
+	n, err := u.Purge(ctx, "user/1/")
+	if err != nil {
+		t.Fatalf("purge failed: %v", err)
+	}
+	if n != 3 || len(fake.versions) != 0 {
+		t.Errorf("purged %d versions, %d left", n, len(fake.versions))
+	}
+
+	if _, err := u.Purge(ctx, ""); err == nil {
+		t.Errorf("expected error purging the whole bucket")
+	}
+	fake.versions = []ObjectVersion{{Key: "locked", VersionID: "v5"}, {Key: "locked/not", VersionID: "v6"}}
+	n, err = u.Purge(ctx, "locked")
+	if err == nil || !strings.Contains(err.Error(), "locked@v5 (AccessDenied)") {
+		t.Errorf("expected error for locked version, got %v", err)
+	}
+	if n != 1 || len(fake.versions) != 1 {
+		t.Errorf("expected 1 version purged despite the error, got %d", n)
+	}
+}
+
+func TestDeleteVersionsValidatesFirst(t *testing.T) {
+	fake := &versionedS3{}
+	u := NewUploader("bucket", "eu-central-1", WithClient(fake))
+	versions := make([]ObjectVersion, 1500)
+	for i := range versions {
+		versions[i] = ObjectVersion{Key: fmt.Sprintf("k/%d", i), VersionID: "v1"}
+	}
+	versions[1200].VersionID = ""
+
+	err := u.DeleteVersions(context.Background(), versions)
+	if err == nil || !strings.Contains(err.Error(), "missing version of k/1200") {
+		t.Errorf("expected missing version error, got %v", err)
+	}
+	if fake.deleteCalls != 0 {
+		t.Errorf("expected no DeleteObjects call, got %d", fake.deleteCalls)
+	}
+}
+
+func TestDownloadVersion(t *testing.T) {
+	fake := newFakeS3()
+	fake.objects["bucket/doc"] = []byte("v2")
+	fake.objects["bucket/doc?versionId=v1"] = []byte("v1")
+	u := NewUploader("bucket", "eu-central-1", WithClient(fake))
+	ctx := context.Background()
+
+	body, err := u.DownloadVersion(ctx, "doc", "v1")
+	if err != nil {
+		t.Fatalf("download failed: %v", err)
+	}
+	data, err := io.ReadAll(body)
+	body.Close()
+	if err != nil || string(data) != "v1" {
+		t.Errorf("unexpected content %q, err %v", data, err)
+	}
+	if _, err := u.DownloadVersion(ctx, "doc", ""); err == nil {
+		t.Errorf("expected error for missing version")
+	}
+	if _, err := u.DownloadVersion(ctx, "doc", "v0"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound for deleted version, got %v", err)
+	}
+}
+
+func TestLifecycleRules(t *testing.T) {
+	ctx := context.Background()
+	fake := &versionedS3{}
+	u := NewUploader("bucket", "eu-central-1", WithClient(fake))
+
+	if err := u.SetLifecycleRule(ctx, LifecycleRule{ID: "tmp", Prefix: "tmp/", ExpireAfterDays: 7}); err != nil {
+		t.Fatalf("set rule failed: %v", err)
+	}
+	if err := u.SetLifecycleRule(ctx, LifecycleRule{ID: "logs", Prefix: "logs/", TransitionAfterDays: 30, TransitionStorageClass: "GLACIER_IR", NoncurrentExpireAfterDays: 90}); err != nil {
+		t.Fatalf("set rule failed: %v", err)
+	}
+	if err := u.SetLifecycleRule(ctx, LifecycleRule{ID: "tmp", Prefix: "tmp/", ExpireAfterDays: 1}); err != nil {
+		t.Fatalf("replace rule failed: %v", err)
+	}
+	rules, err := u.LifecycleRules(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 2 || aws.ToString(rules[1].ID) != "tmp" || aws.ToInt32(rules[1].Expiration.Days) != 1 {
+		t.Errorf("unexpected rules: %+v", rules)
+	}
+	if rules[0].Transitions[0].StorageClass != types.TransitionStorageClassGlacierIr {
+		t.Errorf("unexpected transition: %+v", rules[0].Transitions)
+	}
+
+	if err := u.SetLifecycleRule(ctx, LifecycleRule{ID: "bad", TransitionAfterDays: 30}); err == nil {
+		t.Errorf("expected error for transition without storage class")
+	}
+	for _, id := range []string{"logs", "tmp"} {
+		if err := u.RemoveLifecycleRule(ctx, id); err != nil {
+			t.Fatalf("remove rule failed: %v", err)
+		}
+	}
+	if !fake.deleted {
+		t.Errorf("expected empty lifecycle configuration to be deleted")
+	}
+}
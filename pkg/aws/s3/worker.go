@@ -0,0 +1,190 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/paraopsde/go-x/pkg/util"
+	"go.uber.org/zap"
+)
+
+// Queue is the part of the SQS client used by `Worker`, satisfied by
+// *sqs.Client.
+type Queue interface {
+	ReceiveMessage(ctx context.Context, params *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error)
+	DeleteMessage(ctx context.Context, params *sqs.DeleteMessageInput, optFns ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error)
+}
+
+// EventHandler processes the object announced by `event`, reading its
+// content from `body`.
+type EventHandler func(ctx context.Context, event Event, body io.Reader) error
+
+// WorkerOptions configure a `Worker`.
+type WorkerOptions struct {
+	// Concurrency is the number of messages processed in parallel;
+	// defaults to 1.
+	Concurrency int
+	// WaitTime is how long a receive waits for messages, at most 20s;
+	// defaults to the maximum.
+	WaitTime time.Duration
+	// VisibilityTimeout hides received messages from other workers for
+	// this long, at most 12h; 0 keeps the default of the queue. It must
+	// exceed the time needed to process a message.
+	VisibilityTimeout time.Duration
+}
+
+// Worker processes objects created in the bucket of an Uploader as
+// announced by S3 event notifications.
+type Worker struct {
+	uploader *Uploader
+	handler  EventHandler
+	opts     WorkerOptions
+}
+
+const (
+	maxWaitTime          = 20 * time.Second
+	maxVisibilityTimeout = 12 * time.Hour
+)
+
+// NewWorker returns a worker downloading the objects of `u` announced by
+// events and passing them to `handler`. It fails for options SQS would
+// reject.
+func NewWorker(u *Uploader, handler EventHandler, opts *WorkerOptions) (*Worker, error) {
+	w := &Worker{uploader: u, handler: handler}
+	if opts != nil {
+		w.opts = *opts
+	}
+	if w.opts.WaitTime > maxWaitTime {
+		return nil, fmt.Errorf("wait time %s exceeds %s", w.opts.WaitTime, maxWaitTime)
+	}
+	if w.opts.VisibilityTimeout > maxVisibilityTimeout {
+		return nil, fmt.Errorf("visibility timeout %s exceeds %s", w.opts.VisibilityTimeout, maxVisibilityTimeout)
+	}
+	if w.opts.Concurrency <= 0 {
+		w.opts.Concurrency = 1
+	}
+	if w.opts.WaitTime <= 0 {
+		w.opts.WaitTime = maxWaitTime
+	}
+	return w, nil
+}
+
+// Handle processes the events in `body`, an SQS message body or the
+// payload of a Lambda, so it can be used as Lambda handler:
+//
+//	lambda.Start(func(ctx context.Context, payload json.RawMessage) error {
+//		return worker.Handle(ctx, payload)
+//	})
+//
+// Events other than created objects are ignored, as are objects deleted
+// before they were processed. All events are attempted; the errors are
+// returned joined.
+func (w *Worker) Handle(ctx context.Context, body []byte) error {
+	events, err := ParseEvents(body)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, event := range events {
+		if err := w.handleEvent(ctx, event); err != nil {
+			errs = append(errs, fmt.Errorf("failed to process %s/%s: %w", event.Bucket, event.Key, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (w *Worker) handleEvent(ctx context.Context, event Event) error {
+	log, ctx := util.CtxLogOrInjectNew(ctx)
+	log = log.With(zap.String("bucket", event.Bucket), zap.String("key", event.Key), zap.String("version", event.VersionID), zap.String("event", event.Name))
+	if !event.ObjectCreated() {
+		log.Debug("Ignoring S3 event.")
+		return nil
+	}
+	if event.Bucket != w.uploader.bucket {
+		return fmt.Errorf("event of bucket %s, expected %s", event.Bucket, w.uploader.bucket)
+	}
+	// read the version announced, not one written since
+	body, err := w.uploader.download(ctx, event.Key, "", event.VersionID)
+	if errors.Is(err, ErrNotFound) {
+		log.Warn("Object of S3 event is gone.")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	if err := w.handler(util.CtxWithLog(ctx, log), event, body); err != nil {
+		return err
+	}
+	log.Info("Processed S3 event.")
+	return nil
+}
+
+// Run receives messages from the SQS queue at `queueURL` and processes
+// them until `ctx` is done. Messages are deleted once all of their events
+// were processed; failed ones become visible again after the visibility
+// timeout, to be retried or moved to a dead-letter queue by the queue's
+// redrive policy.
+func (w *Worker) Run(ctx context.Context, queue Queue, queueURL string) error {
+	log, ctx := util.CtxLogOrInjectNew(ctx)
+	log = log.With(zap.String("queue", queueURL))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, w.opts.Concurrency)
+	in := &sqs.ReceiveMessageInput{
+		QueueUrl:            aws.String(queueURL),
+		MaxNumberOfMessages: int32(min(w.opts.Concurrency, 10)),
+		WaitTimeSeconds:     int32(w.opts.WaitTime / time.Second),
+	}
+	if w.opts.VisibilityTimeout > 0 {
+		in.VisibilityTimeout = int32(w.opts.VisibilityTimeout / time.Second)
+	}
+	for ctx.Err() == nil {
+		out, err := queue.ReceiveMessage(ctx, in)
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			log.Error("Failed to receive messages.", zap.Error(err))
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+		for _, msg := range out.Messages {
+			sem <- struct{}{}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() { <-sem }()
+				w.processMessage(ctx, log, queue, queueURL, msg)
+			}()
+		}
+	}
+	wg.Wait()
+	return nil
+}
+
+func (w *Worker) processMessage(ctx context.Context, log *zap.Logger, queue Queue, queueURL string, msg sqstypes.Message) {
+	log = log.With(zap.String("message", aws.ToString(msg.MessageId)))
+	if err := w.Handle(util.CtxWithLog(ctx, log), []byte(aws.ToString(msg.Body))); err != nil {
+		log.Error("Failed to process message.", zap.Error(err))
+		return
+	}
+	// acknowledge processed messages even when stopping
+	_, err := queue.DeleteMessage(context.WithoutCancel(ctx), &sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(queueURL),
+		ReceiptHandle: msg.ReceiptHandle,
+	})
+	if err != nil {
+		log.Error("Failed to delete message.", zap.Error(err))
+	}
+}
@@ -0,0 +1,99 @@
+package s3
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ZipEntry is a file of an archive built by `UploadZip`.
+type ZipEntry struct {
+	Name   string
+	Reader io.Reader
+	// Modified is the modification time recorded; the time of the upload
+	// if zero.
+	Modified time.Time
+	// Store disables compression, e.g. for content that is compressed
+	// already.
+	Store bool
+}
+
+// EntryTransform rewrites the content of an entry while it is streamed
+// into the archive. It matches `zip.EntryContentMutatorFunc` of
+// pkg/zip, so the same functions can be used for both.
+type EntryTransform func(writer io.Writer, reader io.Reader) error
+
+// ZipOptions configure `UploadZip`.
+type ZipOptions struct {
+	// StreamOptions configure the multipart upload of the archive.
+	StreamOptions
+	// Transforms rewrite the content of the entries with matching names.
+	Transforms map[string]EntryTransform
+}
+
+// UploadZip streams a zip archive of `entries` to `key` without holding
+// it in memory or temporary files. Entries are read in order; the caller
+// closes their readers afterwards. `opts` may be nil.
+func (u *Uploader) UploadZip(ctx context.Context, key string, entries []ZipEntry, opts *ZipOptions) error {
+	if opts == nil {
+		opts = &ZipOptions{}
+	}
+	seen := map[string]bool{}
+	for _, entry := range entries {
+		if seen[entry.Name] {
+			return fmt.Errorf("duplicate zip entry %s", entry.Name)
+		}
+		seen[entry.Name] = true
+	}
+
+	pr, pw := io.Pipe()
+	zipErr := make(chan error, 1)
+	go func() {
+		err := writeZip(ctx, pw, entries, opts.Transforms)
+		pw.CloseWithError(err)
+		zipErr <- err
+	}()
+
+	err := u.UploadStream(ctx, key, pr, &opts.StreamOptions)
+	// unblock the writer if the upload stopped reading
+	stopped := fmt.Errorf("upload of %s stopped", key)
+	pr.CloseWithError(stopped)
+	werr := <-zipErr
+	if werr != nil && !errors.Is(werr, stopped) {
+		return fmt.Errorf("failed to write zip %s: %w", key, werr)
+	}
+	return err
+}
+
+func writeZip(ctx context.Context, w io.Writer, entries []ZipEntry, transforms map[string]EntryTransform) error {
+	zipWriter := zip.NewWriter(w)
+	now := time.Now()
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		header := &zip.FileHeader{Name: entry.Name, Method: zip.Deflate, Modified: entry.Modified}
+		if entry.Store {
+			header.Method = zip.Store
+		}
+		if header.Modified.IsZero() {
+			header.Modified = now
+		}
+		entryWriter, err := zipWriter.CreateHeader(header)
+		if err != nil {
+			return fmt.Errorf("failed to create zip entry %s: %w", entry.Name, err)
+		}
+		if transform, ok := transforms[entry.Name]; ok {
+			err = transform(entryWriter, entry.Reader)
+		} else {
+			_, err = io.Copy(entryWriter, entry.Reader)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write zip entry %s: %w", entry.Name, err)
+		}
+	}
+	return zipWriter.Close()
+}
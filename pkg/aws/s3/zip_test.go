@@ -0,0 +1,99 @@
+package s3
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestUploadZip(t *testing.T) {
+	fake := newFakeS3()
+	u := NewUploader("bucket", "eu-central-1", WithClient(fake))
+
+	upper := func(w io.Writer, r io.Reader) error {
+		content, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(bytes.ToUpper(content))
+		return err
+	}
+	entries := []ZipEntry{
+		{Name: "a.txt", Reader: strings.NewReader("first")},
+		{Name: "dir/b.txt", Reader: strings.NewReader("second"), Store: true},
+	}
+	err := u.UploadZip(context.Background(), "bundle.zip", entries, &ZipOptions{
+		Transforms: map[string]EntryTransform{"dir/b.txt": upper},
+	})
+	if err != nil {
+		t.Fatalf("upload failed: %v", err)
+	}
+
+	archive := fake.objects["bucket/bundle.zip"]
+	zipReader, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		t.Fatalf("invalid zip: %v", err)
+	}
+	want := map[string]string{"a.txt": "first", "dir/b.txt": "SECOND"}
+	for _, file := range zipReader.File {
+		r, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(r)
+		r.Close()
+		if err != nil || string(content) != want[file.Name] {
+			t.Errorf("unexpected content of %s: %q, %v", file.Name, content, err)
+		}
+		delete(want, file.Name)
+	}
+	if len(want) != 0 {
+		t.Errorf("missing entries %v", want)
+	}
+}
+
+func TestUploadZipFailingEntry(t *testing.T) {
+	fake := newFakeS3()
+	u := NewUploader("bucket", "eu-central-1", WithClient(fake))
+	failing := errors.New("broken source")
+	entries := []ZipEntry{
+		{Name: "ok.txt", Reader: strings.NewReader("fine")},
+		{Name: "broken.txt", Reader: io.MultiReader(strings.NewReader("partial"), &errReader{failing})},
+	}
+	err := u.UploadZip(context.Background(), "bundle.zip", entries, nil)
+	if !errors.Is(err, failing) {
+		t.Errorf("expected source error, got %v", err)
+	}
+	if _, ok := fake.objects["bucket/bundle.zip"]; ok {
+		t.Errorf("failed upload was stored")
+	}
+}
+
+type errReader struct{ err error }
+
+func (r *errReader) Read([]byte) (int, error) { return 0, r.err }
+
+func TestUploadZipFailingUpload(t *testing.T) {
+	fake := newFakeS3()
+	fake.failPart = 2
+	u := NewUploader("bucket", "eu-central-1", WithClient(fake))
+	entries := []ZipEntry{
+		{Name: "big.bin", Reader: bytes.NewReader(bytes.Repeat([]byte("x"), 3*int(MinPartSize))), Store: true},
+	}
+	err := u.UploadZip(context.Background(), "bundle.zip", entries, &ZipOptions{
+		StreamOptions: StreamOptions{PartSize: MinPartSize, Concurrency: 1},
+	})
+	if err == nil || !strings.Contains(err.Error(), "injected failure") {
+		t.Errorf("expected upload error, got %v", err)
+	}
+	if len(fake.aborted) != 1 {
+		t.Errorf("upload not aborted")
+	}
+	if _, ok := fake.objects["bucket/bundle.zip"]; ok {
+		t.Errorf("failed upload was stored")
+	}
+}
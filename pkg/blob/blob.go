@@ -0,0 +1,86 @@
+// Package blob stores streams of bytes by key, independent of where they
+// end up: S3, a local directory or memory.
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/paraopsde/go-x/pkg/aws/s3"
+)
+
+// ErrNotFound is returned when a blob does not exist.
+var ErrNotFound = errors.New("blob not found")
+
+// Info describes a stored blob.
+type Info struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// BlobStore is implemented by all backends. Keys are slash separated
+// paths like "exports/2024/report.pdf".
+type BlobStore interface {
+	// Put stores everything read from `r` at `key`, replacing an
+	// existing blob.
+	Put(ctx context.Context, key string, r io.Reader) error
+	// Get returns the content of the blob stored at `key`. The caller
+	// must close the returned reader.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Head returns information on the blob stored at `key`.
+	Head(ctx context.Context, key string) (*Info, error)
+	// List iterates over all blobs whose key starts with `prefix` in
+	// lexical order. Iteration stops after the first error.
+	List(ctx context.Context, prefix string) iter.Seq2[Info, error]
+	// Delete removes the blob stored at `key`. Deleting a missing blob
+	// is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// Open returns the store configured by `rawURL`:
+//
+//	s3://bucket/prefix?region=eu-central-1  objects below prefix in an S3 bucket
+//	file:///var/lib/blobs                    files below a local directory
+//	mem://                                   memory, for tests
+//
+// S3 URLs accept the query parameters "region", "endpoint" and
+// "pathstyle" (true or false); credentials are taken from the default
+// AWS configuration.
+func Open(rawURL string) (BlobStore, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse blob store url: %w", err)
+	}
+	switch u.Scheme {
+	case "s3":
+		if u.Host == "" {
+			return nil, fmt.Errorf("missing bucket in %s", rawURL)
+		}
+		query := u.Query()
+		var opts []s3.Option
+		if endpoint := query.Get("endpoint"); endpoint != "" {
+			opts = append(opts, s3.WithEndpoint(endpoint))
+		}
+		if query.Get("pathstyle") == "true" {
+			opts = append(opts, s3.WithPathStyle())
+		}
+		uploader := s3.NewUploader(u.Host, query.Get("region"), opts...)
+		return NewS3(uploader, strings.TrimPrefix(u.Path, "/")), nil
+	case "file":
+		if u.Host != "" && u.Host != "localhost" {
+			return nil, fmt.Errorf("file url %s must not have a host", rawURL)
+		}
+		return NewLocal(filepath.FromSlash(u.Path))
+	case "mem":
+		return NewMemory(), nil
+	}
+	return nil, fmt.Errorf("unsupported blob store scheme %q", u.Scheme)
+}
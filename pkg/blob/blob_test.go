@@ -0,0 +1,115 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestStores(t *testing.T) {
+	local, err := Open((&url.URL{Scheme: "file", Path: t.TempDir()}).String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	mem, err := Open("mem://")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s3Store, _ := newS3Store(t)
+	for name, store := range map[string]BlobStore{"local": local, "memory": mem, "s3": s3Store} {
+		t.Run(name, func(t *testing.T) {
+			testStore(t, store)
+		})
+	}
+}
+
+// testStore checks the contract of BlobStore every store must fulfill.
+func testStore(t *testing.T, store BlobStore) {
+	ctx := context.Background()
+	for _, key := range []string{"a/1.txt", "a/2.txt", "b/1.txt", "a.txt", "a-b/1.txt"} {
+		if err := store.Put(ctx, key, strings.NewReader("content of "+key)); err != nil {
+			t.Fatalf("put %s failed: %v", key, err)
+		}
+	}
+
+	body, err := store.Get(ctx, "a/2.txt")
+	if err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+	content, err := io.ReadAll(body)
+	body.Close()
+	if err != nil || string(content) != "content of a/2.txt" {
+		t.Errorf("unexpected content %q, err %v", content, err)
+	}
+
+	info, err := store.Head(ctx, "b/1.txt")
+	if err != nil || info.Size != int64(len("content of b/1.txt")) {
+		t.Errorf("unexpected info %+v, err %v", info, err)
+	}
+
+	var keys []string
+	for info, err := range store.List(ctx, "a/") {
+		if err != nil {
+			t.Fatalf("list failed: %v", err)
+		}
+		keys = append(keys, info.Key)
+	}
+	if strings.Join(keys, ",") != "a/1.txt,a/2.txt" {
+		t.Errorf("unexpected keys %v", keys)
+	}
+
+	// lexical order, "a-b/" and "a." sort before "a/"
+	keys = nil
+	for info, err := range store.List(ctx, "a") {
+		if err != nil {
+			t.Fatalf("list failed: %v", err)
+		}
+		keys = append(keys, info.Key)
+	}
+	if strings.Join(keys, ",") != "a-b/1.txt,a.txt,a/1.txt,a/2.txt" {
+		t.Errorf("unexpected keys %v", keys)
+	}
+
+	if err := store.Delete(ctx, "a/1.txt"); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if err := store.Delete(ctx, "a/1.txt"); err != nil {
+		t.Errorf("deleting a missing blob failed: %v", err)
+	}
+	if _, err := store.Get(ctx, "a/1.txt"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+	if _, err := store.Head(ctx, "a/1.txt"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestLocalRejectsEscapingKeys(t *testing.T) {
+	store, err := NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"../outside", "/etc/passwd", ""} {
+		if err := store.Put(context.Background(), key, strings.NewReader("x")); err == nil {
+			t.Errorf("put %q should fail", key)
+		}
+	}
+}
+
+func TestOpen(t *testing.T) {
+	store, err := Open("s3://bucket/exports?region=eu-central-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s3Store, ok := store.(*S3Store); !ok || s3Store.prefix != "exports/" {
+		t.Errorf("unexpected store %#v", store)
+	}
+	for _, rawURL := range []string{"ftp://host/path", "s3:///prefix", "file://host/path"} {
+		if _, err := Open(rawURL); err == nil {
+			t.Errorf("open %s should fail", rawURL)
+		}
+	}
+}
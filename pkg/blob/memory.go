@@ -0,0 +1,94 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"iter"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps blobs in memory. It is meant for tests.
+type MemoryStore struct {
+	mu    sync.RWMutex
+	blobs map[string]memoryBlob
+}
+
+type memoryBlob struct {
+	data    []byte
+	modTime time.Time
+}
+
+// NewMemory creates an empty in-memory store.
+func NewMemory() *MemoryStore {
+	return &MemoryStore{blobs: map[string]memoryBlob{}}
+}
+
+func (s *MemoryStore) Put(ctx context.Context, key string, r io.Reader) error {
+	data, err := io.ReadAll(contextReader{ctx, r})
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", key, err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blobs[key] = memoryBlob{data: data, modTime: time.Now()}
+	return nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	blob, ok := s.blobs[key]
+	if !ok {
+		return nil, fmt.Errorf("failed to get %s: %w", key, ErrNotFound)
+	}
+	// blobs are replaced, never modified, so no copy is needed
+	return io.NopCloser(bytes.NewReader(blob.data)), nil
+}
+
+func (s *MemoryStore) Head(ctx context.Context, key string) (*Info, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	blob, ok := s.blobs[key]
+	if !ok {
+		return nil, fmt.Errorf("failed to head %s: %w", key, ErrNotFound)
+	}
+	return &Info{Key: key, Size: int64(len(blob.data)), ModTime: blob.modTime}, nil
+}
+
+// List iterates over a snapshot taken when iteration starts.
+func (s *MemoryStore) List(ctx context.Context, prefix string) iter.Seq2[Info, error] {
+	return func(yield func(Info, error) bool) {
+		s.mu.RLock()
+		infos := make([]Info, 0, len(s.blobs))
+		for key, blob := range s.blobs {
+			if strings.HasPrefix(key, prefix) {
+				infos = append(infos, Info{Key: key, Size: int64(len(blob.data)), ModTime: blob.modTime})
+			}
+		}
+		s.mu.RUnlock()
+		sort.Slice(infos, func(i, j int) bool {
+			return infos[i].Key < infos[j].Key
+		})
+		for _, info := range infos {
+			if err := ctx.Err(); err != nil {
+				yield(Info{}, err)
+				return
+			}
+			if !yield(info, nil) {
+				return
+			}
+		}
+	}
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.blobs, key)
+	return nil
+}
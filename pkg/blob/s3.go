@@ -0,0 +1,88 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"strings"
+
+	"github.com/paraopsde/go-x/pkg/aws/s3"
+)
+
+// S3Store stores blobs as objects below a prefix of an S3 bucket.
+type S3Store struct {
+	uploader *s3.Uploader
+	prefix   string
+}
+
+// NewS3 creates a store keeping blobs below `prefix` in the bucket of
+// `uploader`. A "/" is appended to non-empty prefixes.
+func NewS3(uploader *s3.Uploader, prefix string) *S3Store {
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return &S3Store{uploader: uploader, prefix: prefix}
+}
+
+// Put uploads blobs smaller than one part with a single request and
+// larger ones in parts, so their size need not be known in advance.
+func (s *S3Store) Put(ctx context.Context, key string, r io.Reader) error {
+	head, err := io.ReadAll(io.LimitReader(r, s3.MinPartSize))
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", key, err)
+	}
+	if int64(len(head)) < s3.MinPartSize {
+		return s.uploader.Upload(ctx, s.prefix+key, head)
+	}
+	return s.uploader.UploadStream(ctx, s.prefix+key, io.MultiReader(bytes.NewReader(head), r), nil)
+}
+
+func (s *S3Store) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	body, err := s.uploader.Download(ctx, s.prefix+key)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return body, nil
+}
+
+func (s *S3Store) Head(ctx context.Context, key string) (*Info, error) {
+	obj, err := s.uploader.Head(ctx, s.prefix+key)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &Info{Key: key, Size: obj.Size, ModTime: obj.LastModified}, nil
+}
+
+func (s *S3Store) List(ctx context.Context, prefix string) iter.Seq2[Info, error] {
+	return func(yield func(Info, error) bool) {
+		for obj, err := range s.uploader.List(ctx, s.prefix+prefix) {
+			if err != nil {
+				yield(Info{}, err)
+				return
+			}
+			info := Info{
+				Key:     strings.TrimPrefix(obj.Key, s.prefix),
+				Size:    obj.Size,
+				ModTime: obj.LastModified,
+			}
+			if !yield(info, nil) {
+				return
+			}
+		}
+	}
+}
+
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	return s.uploader.Delete(ctx, s.prefix+key)
+}
+
+// notFound maps `s3.ErrNotFound` to `ErrNotFound`.
+func notFound(err error) error {
+	if errors.Is(err, s3.ErrNotFound) {
+		return fmt.Errorf("%w: %w", ErrNotFound, err)
+	}
+	return err
+}
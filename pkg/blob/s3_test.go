@@ -0,0 +1,58 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"encoding/pem"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/paraopsde/go-x/pkg/aws/s3"
+	"github.com/paraopsde/go-x/pkg/aws/s3/s3test"
+)
+
+// newS3Store returns a store backed by an in-process S3 server.
+func newS3Store(t *testing.T) (*S3Store, *s3test.Server) {
+	t.Helper()
+	server := s3test.NewServer("bucket", "AKID")
+	srv := httptest.NewTLSServer(server)
+	t.Cleanup(srv.Close)
+	u := s3.NewUploader("bucket", "",
+		s3.WithEndpoint(srv.URL),
+		s3.WithPathStyle(),
+		s3.WithStaticCredentials("AKID", "SECRET", ""),
+		s3.WithCACertificates(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})),
+	)
+	return NewS3(u, "blobs"), server
+}
+
+func TestS3StorePut(t *testing.T) {
+	ctx := context.Background()
+	store, server := newS3Store(t)
+
+	if err := store.Put(ctx, "small", strings.NewReader("small")); err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+	if server.Calls("PutObject") != 1 || server.Calls("CreateMultipartUpload") != 0 {
+		t.Errorf("expected a single PutObject")
+	}
+
+	large := bytes.Repeat([]byte("x"), int(s3.MinPartSize)+1)
+	if err := store.Put(ctx, "large", bytes.NewReader(large)); err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+	if server.Calls("CreateMultipartUpload") != 1 {
+		t.Errorf("expected a multipart upload")
+	}
+	body, err := store.Get(ctx, "large")
+	if err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+	content, err := io.ReadAll(body)
+	body.Close()
+	if err != nil || !bytes.Equal(content, large) {
+		t.Errorf("unexpected content of %d bytes, err %v", len(content), err)
+	}
+}
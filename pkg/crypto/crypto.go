@@ -2,8 +2,11 @@ package crypto
 
 import (
 	"bytes"
+	"context"
 	"crypto/cipher"
 	crand "crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/binary"
 	"encoding/hex"
 	"fmt"
@@ -16,6 +19,8 @@ const (
 	chunkSize int = 5 * 1024 * 1024
 	nonceSize int = chacha20poly1305.NonceSize
 	keySize   int = chacha20poly1305.KeySize
+
+	fingerprintDomain = "go-x/crypto key fingerprint v1\x00"
 )
 
 type Key struct {
@@ -23,31 +28,46 @@ type Key struct {
 	aead  cipher.AEAD
 }
 
+// randReader is the entropy source for keys and nonces. It is a variable
+// so tests can simulate a failing source.
+var randReader io.Reader = crand.Reader
+
+// NewKey creates a key from fresh random bytes.
 func NewKey() (*Key, error) {
 	var keybytes [keySize]byte
-	crand.Read(keybytes[:])
+	if _, err := io.ReadFull(randReader, keybytes[:]); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrEntropy, err)
+	}
 	return initKey(keybytes[:])
 }
 
+// NewKeyFromHex creates a key from its hex representation as returned by
+// `Key.Hex`. It fails with `ErrBadKeyLength` unless exactly `keySize`
+// bytes are encoded.
 func NewKeyFromHex(hexstring string) (*Key, error) {
 	keyBytes, err := hex.DecodeString(hexstring)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode hex: %v", err)
+		return nil, fmt.Errorf("%w: failed to decode hex: %w", ErrUnknownFormat, err)
 	}
 	return initKey(keyBytes)
 }
 
+// NewKeyFromBytes creates a key from exactly `keySize` bytes of key
+// material, failing with `ErrBadKeyLength` otherwise.
 func NewKeyFromBytes(keybytes []byte) (*Key, error) {
 	return initKey(keybytes)
 }
 
 func initKey(keybytes []byte) (*Key, error) {
+	if len(keybytes) != keySize {
+		return nil, fmt.Errorf("%w: got %d bytes, want %d", ErrBadKeyLength, len(keybytes), keySize)
+	}
 	key := &Key{}
-	copy(key.bytes[:], keybytes[:keySize])
+	copy(key.bytes[:], keybytes)
 	var err error
 	key.aead, err = chacha20poly1305.New(keybytes)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create aead: %v", err)
+		return nil, fmt.Errorf("%w: failed to create aead: %w", ErrBadKeyLength, err)
 	}
 	return key, nil
 }
@@ -68,62 +88,113 @@ func CountedNonce(nonce []byte, counter uint64) []byte {
 	return newNonce
 }
 
+// ChachaOpenFromReader reads cipher text as written by
+// `ChachaSealFromReader` and writes the opened plain text into an
+// io.Writer. The input is treated as untrusted: chunk sizes are bounded
+// and malformed streams result in `ErrChunkTooLarge`, `ErrTruncated` or
+// `ErrAuthFailed` instead of a panic. Memory use does not depend on the
+// size of the input.
+// Streams starting with a stream header (see `ChachaSealFromReaderWithOptions`)
+// are recognized and the options recorded there, like compression, are
+// reversed transparently.
 func (key *Key) ChachaOpenFromReader(cipherReader io.Reader, plainWriter io.Writer) error {
+	_, err := key.ChachaOpenFromReaderWithOptions(context.Background(), cipherReader, plainWriter, OpenOptions{})
+	return err
+}
+
+// openChunks opens the chunks of a stream, authenticating `ad` as
+// additional data with every chunk. If `expectTrailer` is set, the stream
+// must end with a trailer chunk, whose opened content is returned. `obs`
+// is notified of every opened chunk and may be nil.
+func (key *Key) openChunks(cipherReader io.Reader, plainWriter io.Writer, ad []byte, expectTrailer bool, obs *chunkObserver) ([]byte, error) {
 	var (
-		nonce = make([]byte, chacha20poly1305.NonceSize)
-		chunk []byte
+		header  = make([]byte, 8)
+		nonce   = make([]byte, chacha20poly1305.NonceSize)
+		chunk   []byte
+		trailer []byte
 	)
-	chunk = make([]byte, chunkSize+key.aead.Overhead())
-	idx := 0
-	for {
-		// read chunk size and nonce
-		buf := make([]byte, 8)
-		n, err := io.ReadFull(cipherReader, buf)
-		if err != nil {
-			return fmt.Errorf("failed to read header bytes: %w", err)
+	maxChunkSize := uint64(chunkSize + key.aead.Overhead())
+	for idx := 0; ; idx++ {
+		if err := obs.canceled(); err != nil {
+			return nil, err
 		}
-		if n != 8 {
-			return fmt.Errorf("failed to read header bytes (%d): short read", n)
+
+		// read chunk size and nonce
+		if _, err := io.ReadFull(cipherReader, header); err != nil {
+			return nil, fmt.Errorf("failed to read header of chunk %d: %w", idx, truncated(err))
 		}
-		thisChunkSize := binary.BigEndian.Uint64(buf)
+		thisChunkSize := binary.BigEndian.Uint64(header)
 		if thisChunkSize == 0 {
 			// terminating zero found
 			break
 		}
-		n, err = io.ReadFull(cipherReader, nonce)
-		if err != nil || n != chacha20poly1305.NonceSize {
-			return fmt.Errorf("failed to read nonce bytes (%d): %v", n, err)
+		if trailer != nil {
+			return nil, fmt.Errorf("%w: chunk %d follows trailer", ErrUnknownFormat, idx)
+		}
+		isTrailer := expectTrailer && thisChunkSize&trailerMarker != 0
+		if isTrailer {
+			thisChunkSize &^= trailerMarker
+		}
+		if thisChunkSize > maxChunkSize {
+			return nil, fmt.Errorf("%w: chunk %d has %d bytes (max %d)", ErrChunkTooLarge, idx, thisChunkSize, maxChunkSize)
+		}
+		if thisChunkSize < uint64(key.aead.Overhead()) {
+			return nil, fmt.Errorf("%w: chunk %d has %d bytes", ErrAuthFailed, idx, thisChunkSize)
+		}
+		if _, err := io.ReadFull(cipherReader, nonce); err != nil {
+			return nil, fmt.Errorf("failed to read nonce of chunk %d: %w", idx, truncated(err))
 		}
 
-		// read cipher
-		bytesRead, err := io.ReadFull(cipherReader, chunk[:thisChunkSize])
-		if err != nil {
-			return fmt.Errorf("failed to read %d bytes: %v", thisChunkSize, err)
-		} else if uint64(bytesRead) != thisChunkSize {
-			return fmt.Errorf("invalid size of chunk (%d) read: %v", bytesRead, err)
+		// read cipher, growing the buffer only as far as needed
+		if uint64(cap(chunk)) < thisChunkSize {
+			chunk = make([]byte, thisChunkSize)
+		}
+		chunk = chunk[:thisChunkSize]
+		if _, err := io.ReadFull(cipherReader, chunk); err != nil {
+			return nil, fmt.Errorf("failed to read chunk %d (%d bytes): %w", idx, thisChunkSize, truncated(err))
 		}
 
-		// open chunk
-		plain, err := key.aead.Open(nil, nonce, chunk[:bytesRead], nil)
+		if isTrailer {
+			plain, err := key.aead.Open(nil, nonce, chunk, trailerAD(ad))
+			if err != nil {
+				return nil, fmt.Errorf("%w: trailer", ErrAuthFailed)
+			}
+			trailer = plain
+			continue
+		}
+
+		// open chunk in place
+		plain, err := key.aead.Open(chunk[:0], nonce, chunk, ad)
 		if err != nil {
-			return fmt.Errorf("failed to open chunk: %v", err)
+			return nil, fmt.Errorf("%w: chunk %d", ErrAuthFailed, idx)
 		}
 
 		// write plain
-		bytesWritten, err := plainWriter.Write(plain)
-		if bytesWritten > bytesRead || err != nil {
-			return fmt.Errorf("failed to write (%d): %v", bytesWritten, err)
+		if _, err := plainWriter.Write(plain); err != nil {
+			return nil, fmt.Errorf("failed to write chunk %d: %w", idx, err)
 		}
-		idx++
+		obs.chunkDone(len(plain))
+	}
+	if expectTrailer && trailer == nil {
+		return nil, fmt.Errorf("%w: missing trailer", ErrTruncated)
+	}
+	return trailer, nil
+}
+
+// truncated maps the errors io.ReadFull returns on a premature end of
+// input to `ErrTruncated`.
+func truncated(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrTruncated
 	}
-	return nil
+	return err
 }
 
 func (key *Key) ChachaSeal(plain []byte) ([]byte, error) {
 	cipher := bytes.NewBuffer(make([]byte, 0, len(plain)+key.aead.Overhead()))
 	n, err := key.ChachaSealFromReader(bytes.NewReader(plain), cipher)
 	if err != nil {
-		return nil, fmt.Errorf("failed to seal: %v", err)
+		return nil, fmt.Errorf("failed to seal: %w", err)
 	}
 	if n != int64(cipher.Len()) {
 		return nil, fmt.Errorf("failed to seal: length mismatch (%d/%d)", n, cipher.Len())
@@ -134,10 +205,12 @@ func (key *Key) ChachaSeal(plain []byte) ([]byte, error) {
 // ChachaOpen is a variant using `ChachaOpenFromReader` that takes a slice
 // of bytes instead of an io.Reader
 func (key *Key) ChachaOpen(cipher []byte) ([]byte, error) {
-	plain := bytes.NewBuffer(make([]byte, 0, len(cipher)))
-	err := key.ChachaOpenFromReader(bytes.NewReader(cipher), plain)
+	// the plain text is not preallocated: the length of untrusted input
+	// says nothing reliable about what it will open to.
+	var plain bytes.Buffer
+	err := key.ChachaOpenFromReader(bytes.NewReader(cipher), &plain)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open: %v", err)
+		return nil, fmt.Errorf("failed to open: %w", err)
 	}
 	return plain.Bytes(), nil
 }
@@ -150,15 +223,30 @@ func (key *Key) ChachaOpen(cipher []byte) ([]byte, error) {
 // Following the final chunk a 64bit zero is written to denote the end
 // of the cipher text.
 func (key *Key) ChachaSealFromReader(plainReader io.Reader, cipherWriter io.Writer) (int64, error) {
+	return key.sealChunks(plainReader, cipherWriter, nil, nil, nil)
+}
+
+// sealChunks implements the chunked sealing of `ChachaSealFromReader`,
+// authenticating `ad` as additional data with every chunk. If `trailer`
+// is set, the data it returns once all plain text has been read is
+// sealed as a trailer chunk in front of the terminating zero. `obs` is
+// notified of every sealed chunk and may be nil.
+func (key *Key) sealChunks(plainReader io.Reader, cipherWriter io.Writer, ad []byte, trailer func() []byte, obs *chunkObserver) (int64, error) {
 	var (
 		primeNonce   = make([]byte, chacha20poly1305.NonceSize)
 		chunk        = make([]byte, chunkSize)
 		nonceInc     uint64
 		bytesWritten int64
 	)
-	crand.Read(primeNonce[:])
+	if _, err := io.ReadFull(randReader, primeNonce); err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrEntropy, err)
+	}
 
 	for eof := false; !eof; {
+		if err := obs.canceled(); err != nil {
+			return 0, err
+		}
+
 		// read plain
 		bytesRead, err := io.ReadFull(plainReader, chunk)
 		if err != nil {
@@ -176,35 +264,24 @@ func (key *Key) ChachaSealFromReader(plainReader io.Reader, cipherWriter io.Writ
 		// seal chunk
 		nonce := CountedNonce(primeNonce, nonceInc)
 		nonceInc++
-		cipher := key.aead.Seal(nil, nonce, chunk[:bytesRead], nil)
+		cipher := key.aead.Seal(nil, nonce, chunk[:bytesRead], ad)
 
-		// write nonce and chunk size (of cipher)
-		buf := make([]byte, 8)
-		binary.BigEndian.PutUint64(buf, uint64(len(cipher)))
-		n, e := cipherWriter.Write(buf)
-		if e != nil {
-			return 0, fmt.Errorf("failed to write chunk header: %w", e)
-		}
-		if n != 8 {
-			return 0, fmt.Errorf("failed to write chunk header: short write (%d)", n)
-		}
-		bytesWritten += int64(n)
-
-		n, e = cipherWriter.Write(nonce)
-		if e != nil {
-			return 0, fmt.Errorf("failed to write chunk nonce: %w", e)
-		}
-		if n != chacha20poly1305.NonceSize {
-			return 0, fmt.Errorf("failed to write chunk nonce: short write (%d)", n)
+		n, err := writeChunk(cipherWriter, uint64(len(cipher)), nonce, cipher)
+		if err != nil {
+			return 0, err
 		}
-		bytesWritten += int64(n)
+		bytesWritten += n
+		obs.chunkDone(bytesRead)
+	}
 
-		// write cipher
-		n, err = cipherWriter.Write(cipher)
-		if n < bytesRead || err != nil {
-			return 0, fmt.Errorf("failed to write (%d): %v", n, err)
+	if trailer != nil {
+		nonce := CountedNonce(primeNonce, nonceInc)
+		cipher := key.aead.Seal(nil, nonce, trailer(), trailerAD(ad))
+		n, err := writeChunk(cipherWriter, uint64(len(cipher))|trailerMarker, nonce, cipher)
+		if err != nil {
+			return 0, err
 		}
-		bytesWritten += int64(n)
+		bytesWritten += n
 	}
 
 	// write a terminating zero
@@ -221,6 +298,54 @@ func (key *Key) ChachaSealFromReader(plainReader io.Reader, cipherWriter io.Writ
 	return bytesWritten, nil
 }
 
+// writeChunk writes the size (of cipher), nonce and cipher of a chunk.
+func writeChunk(cipherWriter io.Writer, size uint64, nonce, cipher []byte) (int64, error) {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, size)
+	n, e := cipherWriter.Write(buf)
+	if e != nil {
+		return 0, fmt.Errorf("failed to write chunk header: %w", e)
+	}
+	if n != 8 {
+		return 0, fmt.Errorf("failed to write chunk header: short write (%d)", n)
+	}
+
+	n, e = cipherWriter.Write(nonce)
+	if e != nil {
+		return 0, fmt.Errorf("failed to write chunk nonce: %w", e)
+	}
+	if n != chacha20poly1305.NonceSize {
+		return 0, fmt.Errorf("failed to write chunk nonce: short write (%d)", n)
+	}
+
+	n, e = cipherWriter.Write(cipher)
+	if n < len(cipher) || e != nil {
+		return 0, fmt.Errorf("failed to write (%d): %w", n, e)
+	}
+	return int64(8 + len(nonce) + len(cipher)), nil
+}
+
+// Equal reports whether both keys hold the same key material. The
+// comparison takes constant time.
+func (key *Key) Equal(other *Key) bool {
+	if key == nil || other == nil {
+		return key == other
+	}
+	return subtle.ConstantTimeCompare(key.bytes[:], other.bytes[:]) == 1
+}
+
+// Fingerprint returns a short identifier of the key that is safe to log:
+// the first 8 bytes of a domain separated SHA-256 of the key material.
+func (key *Key) Fingerprint() string {
+	if key == nil {
+		return "nil"
+	}
+	h := sha256.New()
+	h.Write([]byte(fingerprintDomain))
+	h.Write(key.bytes[:])
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
+
 func (key *Key) Hex() string {
 	if key == nil {
 		return "nil"
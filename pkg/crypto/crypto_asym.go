@@ -1,11 +1,13 @@
 package crypto
 
 import (
+	"crypto/ecdh"
+	"crypto/mlkem"
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
-	"errors"
 	"fmt"
+	"io"
 
 	"github.com/kevinburke/nacl"
 	"github.com/kevinburke/nacl/box"
@@ -16,77 +18,232 @@ const (
 	asymKeySize int = nacl.KeySize
 )
 
+// AsymKey is an X25519 key pair, optionally accompanied by an independent
+// ML-KEM-768 key pair for `KEMX25519MLKEM768`, see `NewKeyPairWithMLKEM`.
+// Public keys loaded with `NewPublicKeyFromHex` can seal, but not open.
 type AsymKey struct {
 	private nacl.Key
 	public  nacl.Key
+	// mlkem is nil for public keys and key pairs created without an
+	// ML-KEM key, see `AddMLKEMKey`.
+	mlkem       *mlkem.DecapsulationKey768
+	mlkemPublic *mlkem.EncapsulationKey768
 }
 
-var ErrWrongHolder = errors.New("wrong holder")
-
+// NewKeyPair creates an X25519 key pair from fresh random bytes. See
+// `NewKeyPairWithMLKEM` for key pairs usable with `KEMX25519MLKEM768`.
 func NewKeyPair() *AsymKey {
 	akey := &AsymKey{private: nacl.NewKey()}
 	akey.calcPublic()
 	return akey
 }
 
-func NewKeyPairFromPrivateHex(hex string) (*AsymKey, error) {
-	key, err := nacl.Load(hex)
+// NewKeyPairWithMLKEM creates an X25519 key pair accompanied by an
+// ML-KEM-768 key pair, so it can be used with `KEMX25519MLKEM768`.
+func NewKeyPairWithMLKEM() (*AsymKey, error) {
+	private := new([asymKeySize]byte)
+	if _, err := io.ReadFull(randReader, private[:]); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrEntropy, err)
+	}
+	akey := &AsymKey{private: private}
+	akey.calcPublic()
+	if err := akey.AddMLKEMKey(); err != nil {
+		return nil, err
+	}
+	return akey, nil
+}
+
+// NewKeyPairFromPrivateHex restores a key pair from its hex
+// representation as returned by `PrivateHex`: the X25519 private key,
+// followed by the seed of the ML-KEM-768 key if the key pair has one.
+func NewKeyPairFromPrivateHex(hexstring string) (*AsymKey, error) {
+	raw, err := hex.DecodeString(hexstring)
 	if err != nil {
-		return nil, fmt.Errorf("failed to load: %v", err)
+		return nil, fmt.Errorf("%w: failed to decode hex: %w", ErrUnknownFormat, err)
+	}
+	if len(raw) != asymKeySize && len(raw) != asymKeySize+mlkem.SeedSize {
+		return nil, fmt.Errorf("%w: got %d bytes, want %d or %d", ErrBadKeyLength, len(raw), asymKeySize, asymKeySize+mlkem.SeedSize)
 	}
-	akey := &AsymKey{private: key}
+	akey := &AsymKey{private: new([asymKeySize]byte)}
+	copy(akey.private[:], raw[:asymKeySize])
 	akey.calcPublic()
+	if len(raw) > asymKeySize {
+		if akey.mlkem, err = mlkem.NewDecapsulationKey768(raw[asymKeySize:]); err != nil {
+			return nil, fmt.Errorf("%w: failed to load mlkem key: %w", ErrUnknownFormat, err)
+		}
+		akey.mlkemPublic = akey.mlkem.EncapsulationKey()
+	}
+	return akey, nil
+}
+
+// NewPublicKeyFromHex loads the public keys of a key pair as returned by
+// `PublicHex` and `MLKEMPublicHex`, e.g. to seal keys on hosts that must
+// not be able to open them. `mlkemPublicHex` may be empty, which rules
+// out `KEMX25519MLKEM768`.
+func NewPublicKeyFromHex(publicHex, mlkemPublicHex string) (*AsymKey, error) {
+	public, err := nacl.Load(publicHex)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to load: %w", ErrUnknownFormat, err)
+	}
+	akey := &AsymKey{public: public}
+	if mlkemPublicHex != "" {
+		raw, err := hex.DecodeString(mlkemPublicHex)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to decode mlkem hex: %w", ErrUnknownFormat, err)
+		}
+		if akey.mlkemPublic, err = mlkem.NewEncapsulationKey768(raw); err != nil {
+			return nil, fmt.Errorf("%w: failed to load mlkem key: %w", ErrUnknownFormat, err)
+		}
+	}
 	return akey, nil
 }
 
+// AddMLKEMKey adds a fresh ML-KEM-768 key pair to a key pair created or
+// restored without one, so it can be used with `KEMX25519MLKEM768`. The result of
+// `PrivateHex` changes accordingly and must be stored again. Key pairs
+// that have an ML-KEM key keep it.
+func (akey *AsymKey) AddMLKEMKey() error {
+	if akey.private == nil {
+		return ErrPublicKeyOnly
+	}
+	if akey.mlkem != nil {
+		return nil
+	}
+	seed := make([]byte, mlkem.SeedSize)
+	if _, err := io.ReadFull(randReader, seed); err != nil {
+		return fmt.Errorf("%w: %w", ErrEntropy, err)
+	}
+	decapKey, err := mlkem.NewDecapsulationKey768(seed)
+	if err != nil {
+		return fmt.Errorf("failed to create mlkem key: %w", err)
+	}
+	akey.mlkem = decapKey
+	akey.mlkemPublic = decapKey.EncapsulationKey()
+	return nil
+}
+
+// SealSymKey seals `symkey` for this key pair using X25519 with an
+// ephemeral sender key, so only the public key is needed. See
+// `SealSymKeyWithKEM` for other key encapsulation mechanisms.
 func (akey *AsymKey) SealSymKey(symkey *Key) (string, error) {
-	sealmap := map[string]string{
-		"holder":    akey.PublicHex(),
-		"encrypter": akey.PublicHex(),
-		"cipher":    base64.StdEncoding.EncodeToString(box.EasySeal(symkey.bytes[:], akey.public, akey.private)),
+	sealmap, err := sealToPublic(akey.PublicHex(), symkey.bytes[:])
+	if err != nil {
+		return "", err
 	}
+	sealmap["kem"] = string(KEMX25519)
 	sealedJson, err := json.Marshal(sealmap)
 	if err != nil {
-		return "", fmt.Errorf("failed to json-marshal: %v", err)
+		return "", fmt.Errorf("failed to json-marshal: %w", err)
 	}
 	return string(sealedJson), nil
 }
 
+// OpenSymKey opens a key sealed by `SealSymKey` or `SealSymKeyWithKEM`.
+// Envelopes without a recorded KEM are treated as X25519.
 func (akey *AsymKey) OpenSymKey(sealed string) (*Key, error) {
+	sealmap, err := akey.unmarshalSealed(sealed)
+	if err != nil {
+		return nil, err
+	}
+	switch KEM(sealmap["kem"]) {
+	case "", KEMX25519:
+	case KEMX25519MLKEM768:
+		return akey.openHybrid(sealmap)
+	default:
+		return nil, fmt.Errorf("%w: kem %q", ErrUnknownFormat, sealmap["kem"])
+	}
+
+	plainBytes, err := akey.openBox(sealmap)
+	if err != nil {
+		return nil, err
+	}
+	return NewKeyFromBytes(plainBytes)
+}
+
+// sealToPublic seals `plain` for the holder of the X25519 public key
+// `holderPublicHex` using a NaCl box from an ephemeral key pair. The
+// resulting envelope is opened by `openBox`.
+func sealToPublic(holderPublicHex string, plain []byte) (map[string]string, error) {
+	holderPublic, err := nacl.Load(holderPublicHex)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to load holder: %w", ErrUnknownFormat, err)
+	}
+	ephemeral, err := ecdh.X25519().GenerateKey(randReader)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrEntropy, err)
+	}
+	ephemeralPrivate := new([asymKeySize]byte)
+	copy(ephemeralPrivate[:], ephemeral.Bytes())
+	return map[string]string{
+		"holder":    hex.EncodeToString(holderPublic[:]),
+		"encrypter": hex.EncodeToString(ephemeral.PublicKey().Bytes()),
+		"cipher":    base64.StdEncoding.EncodeToString(box.EasySeal(plain, holderPublic, ephemeralPrivate)),
+	}, nil
+}
+
+func (akey *AsymKey) unmarshalSealed(sealed string) (map[string]string, error) {
 	sealmap := map[string]string{}
 	if err := json.Unmarshal([]byte(sealed), &sealmap); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal: %v", err)
+		return nil, fmt.Errorf("%w: failed to unmarshal: %w", ErrUnknownFormat, err)
+	}
+	if akey.private == nil {
+		return nil, ErrPublicKeyOnly
 	}
 	if sealmap["holder"] != akey.PublicHex() {
 		return nil, fmt.Errorf("%w: %s != %s", ErrWrongHolder, sealmap["holder"], akey.PublicHex())
 	}
+	return sealmap, nil
+}
 
+// openBox opens the NaCl box of an envelope that has been sealed for
+// this key pair.
+func (akey *AsymKey) openBox(sealmap map[string]string) ([]byte, error) {
 	cipher, err := base64.StdEncoding.DecodeString(sealmap["cipher"])
 	if err != nil {
-		return nil, fmt.Errorf("failed to base64 decode cipher: %v", err)
+		return nil, fmt.Errorf("%w: failed to base64 decode cipher: %w", ErrUnknownFormat, err)
 	}
 	encrypterBytes, err := hex.DecodeString(sealmap["encrypter"])
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode encrypter: %v", err)
+		return nil, fmt.Errorf("%w: failed to decode encrypter: %w", ErrUnknownFormat, err)
+	}
+	if len(encrypterBytes) != asymKeySize {
+		return nil, fmt.Errorf("%w: encrypter has %d bytes", ErrBadKeyLength, len(encrypterBytes))
 	}
 	encrypterPublic := new([asymKeySize]byte)
 	copy(encrypterPublic[:], encrypterBytes[:asymKeySize])
 	plainBytes, err := box.EasyOpen(cipher, encrypterPublic, akey.private)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decrypt: %v", err)
+		return nil, fmt.Errorf("%w: failed to decrypt: %w", ErrAuthFailed, err)
 	}
-	return NewKeyFromBytes(plainBytes)
+	return plainBytes, nil
 }
 
+// PrivateHex returns the hex representation of the private keys, which
+// `NewKeyPairFromPrivateHex` restores the key pair from.
 func (akey *AsymKey) PrivateHex() string {
-	return fmt.Sprintf("%x", *akey.private)
+	if akey.private == nil {
+		return ""
+	}
+	if akey.mlkem == nil {
+		return fmt.Sprintf("%x", *akey.private)
+	}
+	return fmt.Sprintf("%x%x", *akey.private, akey.mlkem.Bytes())
 }
 func (akey *AsymKey) PublicHex() string {
 	return fmt.Sprintf("%x", *akey.public)
 }
 
+// MLKEMPublicHex returns the hex representation of the ML-KEM-768
+// encapsulation key, or "" if the key pair has none.
+func (akey *AsymKey) MLKEMPublicHex() string {
+	if akey.mlkemPublic == nil {
+		return ""
+	}
+	return hex.EncodeToString(akey.mlkemPublic.Bytes())
+}
+
 func (akey *AsymKey) VerboseHex() string {
-	return fmt.Sprintf("%x(priv)\n%x(pub)\n", *akey.private, *akey.public)
+	return fmt.Sprintf("%s(priv)\n%x(pub)\n", akey.PrivateHex(), *akey.public)
 }
 
 func (akey *AsymKey) calcPublic() {
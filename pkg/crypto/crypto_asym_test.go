@@ -0,0 +1,36 @@
+package crypto
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSealOpenSymKeyErrors(t *testing.T) {
+	req := require.New(t)
+
+	k, err := NewKey()
+	req.NoError(err, "key creation should succeed")
+	akey := NewKeyPair()
+
+	sealed, err := akey.SealSymKey(k)
+	req.NoError(err, "sealing should succeed")
+	opened, err := akey.OpenSymKey(sealed)
+	req.NoError(err, "opening should succeed")
+	req.Equal(k.Hex(), opened.Hex())
+
+	_, err = NewKeyPair().OpenSymKey(sealed)
+	req.ErrorIs(err, ErrWrongHolder)
+
+	_, err = akey.OpenSymKey("not json")
+	req.ErrorIs(err, ErrUnknownFormat)
+
+	sealmap := map[string]string{}
+	req.NoError(json.Unmarshal([]byte(sealed), &sealmap))
+	sealmap["cipher"] = "AAAA" + sealmap["cipher"][4:]
+	tampered, err := json.Marshal(sealmap)
+	req.NoError(err)
+	_, err = akey.OpenSymKey(string(tampered))
+	req.ErrorIs(err, ErrAuthFailed)
+}
@@ -2,6 +2,9 @@ package crypto
 
 import (
 	"bytes"
+	crand "crypto/rand"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"reflect"
 	"testing"
@@ -81,3 +84,115 @@ func TestNonces(t *testing.T) {
 	shortNonce := [8]byte{}
 	fmt.Printf("nonce8+3: %x\n", CountedNonce(shortNonce[:], 3))
 }
+
+func TestChachaOpenMalformed(t *testing.T) {
+	req := require.New(t)
+
+	k, err := NewKey()
+	req.NoError(err, "key creation should succeed")
+	cipher, err := k.ChachaSeal([]byte("Hello World"))
+	req.NoError(err, "chacha seal should succeed")
+
+	oversized := make([]byte, 8)
+	binary.BigEndian.PutUint64(oversized, 1<<62)
+	_, err = k.ChachaOpen(oversized)
+	req.ErrorIs(err, ErrChunkTooLarge)
+
+	for _, cut := range []int{0, 4, 8, 12, 30, len(cipher) - 1} {
+		_, err = k.ChachaOpen(cipher[:cut])
+		req.ErrorIs(err, ErrTruncated, "cut at %d", cut)
+	}
+
+	tampered := append([]byte{}, cipher...)
+	tampered[len(tampered)-9] ^= 1
+	_, err = k.ChachaOpen(tampered)
+	req.ErrorIs(err, ErrAuthFailed)
+}
+
+func FuzzChachaOpen(f *testing.F) {
+	k, err := NewKeyFromHex("000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f")
+	if err != nil {
+		f.Fatalf("failed to create key: %v", err)
+	}
+	valid, err := k.ChachaSeal([]byte("Hello World"))
+	if err != nil {
+		f.Fatalf("failed to seal: %v", err)
+	}
+
+	headered, err := k.ChachaSealWithOptions([]byte("Hello World"), SealOptions{})
+	if err != nil {
+		f.Fatalf("failed to seal: %v", err)
+	}
+	compressed, err := k.ChachaSealWithOptions([]byte("Hello World"), SealOptions{Compression: CompressionGzip})
+	if err != nil {
+		f.Fatalf("failed to seal: %v", err)
+	}
+
+	f.Add(valid)
+	f.Add(valid[:len(valid)-8])
+	f.Add(headered)
+	f.Add(headered[:len(headered)-8])
+	f.Add(compressed)
+	f.Add(compressed[:streamHeaderSize])
+	f.Add([]byte(streamMagic + "\x02\x00\x01"))
+	f.Add([]byte{})
+	f.Add([]byte{0, 0, 0, 0, 0, 0, 0, 0})
+	f.Add([]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+	f.Add([]byte{0, 0, 0, 0, 0, 0, 0, 1, 0})
+	f.Add([]byte{0, 0, 0, 0, 0, 0x50, 0, 0x10})
+
+	f.Fuzz(func(t *testing.T, cipher []byte) {
+		plain, err := k.ChachaOpen(cipher)
+		if err != nil {
+			if !errors.Is(err, ErrChunkTooLarge) && !errors.Is(err, ErrTruncated) && !errors.Is(err, ErrAuthFailed) && !errors.Is(err, ErrUnknownFormat) {
+				t.Errorf("unexpected error type: %v", err)
+			}
+			return
+		}
+		// compressed plain text may well exceed its cipher text
+		compressed := len(cipher) >= streamHeaderSize && isStreamHeader(cipher) && Compression(cipher[len(streamMagic)+1]) != CompressionNone
+		if len(plain) > len(cipher) && !compressed {
+			t.Errorf("plain text (%d) larger than cipher text (%d)", len(plain), len(cipher))
+		}
+	})
+}
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errors.New("no entropy")
+}
+
+func TestKeyConstructors(t *testing.T) {
+	req := require.New(t)
+
+	for _, size := range []int{0, 16, keySize - 1, keySize + 1} {
+		_, err := NewKeyFromBytes(make([]byte, size))
+		req.ErrorIs(err, ErrBadKeyLength, "size %d", size)
+	}
+	_, err := NewKeyFromHex("0011")
+	req.ErrorIs(err, ErrBadKeyLength)
+	_, err = NewKeyFromHex("not hex")
+	req.ErrorIs(err, ErrUnknownFormat)
+
+	k, err := NewKey()
+	req.NoError(err, "key creation should succeed")
+	same, err := NewKeyFromHex(k.Hex())
+	req.NoError(err, "key creation from hex should succeed")
+	other, err := NewKey()
+	req.NoError(err, "key creation should succeed")
+
+	req.True(k.Equal(same))
+	req.False(k.Equal(other))
+	req.False(k.Equal(nil))
+	req.Equal(k.Fingerprint(), same.Fingerprint())
+	req.NotEqual(k.Fingerprint(), other.Fingerprint())
+	req.NotContains(k.Hex(), k.Fingerprint())
+
+	randReader = failingReader{}
+	defer func() { randReader = crand.Reader }()
+	_, err = NewKey()
+	req.ErrorIs(err, ErrEntropy)
+	_, err = k.ChachaSeal([]byte("Hello World"))
+	req.ErrorIs(err, ErrEntropy)
+}
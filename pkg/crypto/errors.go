@@ -0,0 +1,36 @@
+package crypto
+
+import "errors"
+
+// Errors returned by this package. They are wrapped with additional
+// context, so use `errors.Is` to test for them.
+var (
+	// ErrAuthFailed is returned when cipher text fails authentication,
+	// i.e. it has been tampered with or was sealed with a different key.
+	ErrAuthFailed = errors.New("authentication failed")
+	// ErrTruncated is returned when cipher text ends prematurely.
+	ErrTruncated = errors.New("truncated cipher text")
+	// ErrChunkTooLarge is returned when a chunk header announces more
+	// bytes than the sealer ever produces.
+	ErrChunkTooLarge = errors.New("chunk too large")
+	// ErrBadKeyLength is returned when key material has the wrong size.
+	ErrBadKeyLength = errors.New("bad key length")
+	// ErrEntropy is returned when the random source fails to deliver
+	// bytes for keys or nonces.
+	ErrEntropy = errors.New("entropy source failed")
+	// ErrUnknownFormat is returned when input cannot be decoded, e.g. a
+	// sealed key that is not valid JSON or contains invalid encodings.
+	ErrUnknownFormat = errors.New("unknown format")
+	// ErrInvalidShares is returned when secret sharing parameters are out
+	// of range or shares are insufficient or inconsistent.
+	ErrInvalidShares = errors.New("invalid shares")
+	// ErrWrongHolder is returned when a sealed key is opened by a key
+	// pair other than the one it was sealed for.
+	ErrWrongHolder = errors.New("wrong holder")
+	// ErrMissingMLKEM is returned when a key pair without ML-KEM-768 key
+	// is used with `KEMX25519MLKEM768`, see `AsymKey.AddMLKEMKey`.
+	ErrMissingMLKEM = errors.New("key pair has no ML-KEM-768 key")
+	// ErrPublicKeyOnly is returned when a public key loaded with
+	// `NewPublicKeyFromHex` is used to open sealed data.
+	ErrPublicKeyOnly = errors.New("public key only")
+)
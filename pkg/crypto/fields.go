@@ -0,0 +1,256 @@
+package crypto
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+const (
+	fieldTag = "crypt"
+
+	fieldDomain = "go-x/crypto field v1\x00"
+)
+
+// EncryptFields walks the struct pointed to by `v` and replaces the value
+// of every string or []byte field tagged with `crypt:"..."` by its
+// base64 encoded cipher text. Untagged fields holding structs, pointers
+// to structs, or slices, arrays, maps and interfaces of them are
+// descended into, so nested records are handled as well. A tag value of
+// "-" excludes a field along with everything nested in it. Structs
+// reachable by several pointers are encrypted once.
+//
+// Every value, including an empty one, is sealed as a single
+// authenticated message bound to the name of its field, so values cannot
+// be swapped between differently named fields unnoticed; renaming a
+// field requires decrypting and encrypting its values again. All fields
+// are checked before the first one is encrypted, so `v` is left unchanged
+// if a tagged field has an unsupported type.
+//
+//	type user struct {
+//		Id    string
+//		EMail string `crypt:"pii"`
+//	}
+func EncryptFields(key *Key, v interface{}) error {
+	return walkFields(v, func(name string, plain []byte) ([]byte, error) {
+		cipher, err := key.sealField(name, plain)
+		if err != nil {
+			return nil, err
+		}
+		encoded := make([]byte, base64.StdEncoding.EncodedLen(len(cipher)))
+		base64.StdEncoding.Encode(encoded, cipher)
+		return encoded, nil
+	})
+}
+
+// DecryptFields reverses `EncryptFields` on the struct pointed to by `v`.
+// Values that fail to decrypt, e.g. as they were moved from another
+// field, result in `ErrAuthFailed`; fields processed before keep their
+// decrypted value.
+func DecryptFields(key *Key, v interface{}) error {
+	return walkFields(v, func(name string, encoded []byte) ([]byte, error) {
+		cipher := make([]byte, base64.StdEncoding.DecodedLen(len(encoded)))
+		n, err := base64.StdEncoding.Decode(cipher, encoded)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to base64 decode: %w", ErrUnknownFormat, err)
+		}
+		return key.openField(name, cipher[:n])
+	})
+}
+
+// sealField seals `plain` as a nonce followed by the cipher text,
+// authenticating the name of the field as additional data.
+func (key *Key) sealField(name string, plain []byte) ([]byte, error) {
+	nonce := make([]byte, nonceSize, nonceSize+len(plain)+key.aead.Overhead())
+	if _, err := io.ReadFull(randReader, nonce); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrEntropy, err)
+	}
+	return key.aead.Seal(nonce, nonce, plain, fieldAD(name)), nil
+}
+
+// openField reverses `sealField`.
+func (key *Key) openField(name string, cipher []byte) ([]byte, error) {
+	if len(cipher) < nonceSize+key.aead.Overhead() {
+		return nil, fmt.Errorf("%w: %d bytes", ErrTruncated, len(cipher))
+	}
+	plain, err := key.aead.Open(nil, cipher[:nonceSize], cipher[nonceSize:], fieldAD(name))
+	if err != nil {
+		return nil, ErrAuthFailed
+	}
+	return plain, nil
+}
+
+// fieldAD returns the additional data binding cipher text to the field
+// `name`.
+func fieldAD(name string) []byte {
+	return []byte(fieldDomain + name)
+}
+
+// taggedField is a field to be processed by `walkFields`.
+type taggedField struct {
+	name  string
+	value reflect.Value
+}
+
+// fieldWalk collects the tagged fields of a struct. Map values are not
+// addressable, so structs stored in maps are collected from copies,
+// which `writeBack` stores in their maps once processed.
+type fieldWalk struct {
+	fields    []taggedField
+	writeBack []func()
+	// visited holds the pointers already descended into, which stops
+	// cycles. A struct and its first field share an address, so
+	// pointers are told apart by type as well.
+	visited map[visitedPointer]bool
+}
+
+type visitedPointer struct {
+	addr uintptr
+	typ  reflect.Type
+}
+
+func walkFields(v interface{}, fn func(name string, value []byte) ([]byte, error)) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("expected non-nil pointer to struct, got %T", v)
+	}
+	walk := &fieldWalk{visited: map[visitedPointer]bool{{rv.Pointer(), rv.Type()}: true}}
+	if err := walk.collectFields(rv.Elem()); err != nil {
+		return err
+	}
+
+	// copies are stored even on error, as fields processed keep their
+	// new value
+	defer func() {
+		for _, store := range walk.writeBack {
+			store()
+		}
+	}()
+	for _, field := range walk.fields {
+		switch field.value.Kind() {
+		case reflect.String:
+			out, err := fn(field.name, []byte(field.value.String()))
+			if err != nil {
+				return fmt.Errorf("failed to process field %s: %w", field.name, err)
+			}
+			field.value.SetString(string(out))
+		case reflect.Slice:
+			out, err := fn(field.name, field.value.Bytes())
+			if err != nil {
+				return fmt.Errorf("failed to process field %s: %w", field.name, err)
+			}
+			field.value.SetBytes(out)
+		}
+	}
+	return nil
+}
+
+// collectFields collects the tagged fields of the struct `rv` and the
+// structs nested in it, failing on tagged fields of unsupported types.
+func (walk *fieldWalk) collectFields(rv reflect.Value) error {
+	rt := rv.Type()
+	for idx := 0; idx < rt.NumField(); idx++ {
+		field := rt.Field(idx)
+		value := rv.Field(idx)
+		if !field.IsExported() {
+			continue
+		}
+
+		tag, tagged := field.Tag.Lookup(fieldTag)
+		if tag == "-" {
+			continue
+		}
+		if !tagged {
+			if err := walk.collectNested(value); err != nil {
+				return fmt.Errorf("%s: %w", field.Name, err)
+			}
+			continue
+		}
+
+		switch {
+		case value.Kind() == reflect.String:
+			walk.fields = append(walk.fields, taggedField{name: field.Name, value: value})
+		case value.Kind() == reflect.Slice && value.Type().Elem().Kind() == reflect.Uint8:
+			if !value.IsNil() {
+				walk.fields = append(walk.fields, taggedField{name: field.Name, value: value})
+			}
+		default:
+			return fmt.Errorf("field %s: unsupported type %s for tag %q", field.Name, value.Type(), fieldTag)
+		}
+	}
+	return nil
+}
+
+// collectNested descends into `value` if it may hold structs.
+func (walk *fieldWalk) collectNested(value reflect.Value) error {
+	switch value.Kind() {
+	case reflect.Struct:
+		return walk.collectFields(value)
+	case reflect.Ptr:
+		visited := visitedPointer{value.Pointer(), value.Type()}
+		if value.IsNil() || walk.visited[visited] {
+			return nil
+		}
+		walk.visited[visited] = true
+		return walk.collectNested(value.Elem())
+	case reflect.Interface:
+		if value.IsNil() {
+			return nil
+		}
+		if elem := value.Elem(); elem.Kind() != reflect.Ptr && mayHoldStructs(elem.Type()) {
+			if !value.CanSet() {
+				return fmt.Errorf("cannot update %s held by an interface", elem.Type())
+			}
+			return walk.collectCopy(elem, value.Set)
+		}
+		return walk.collectNested(value.Elem())
+	case reflect.Slice, reflect.Array:
+		if !mayHoldStructs(value.Type().Elem()) {
+			return nil
+		}
+		for idx := 0; idx < value.Len(); idx++ {
+			if err := walk.collectNested(value.Index(idx)); err != nil {
+				return fmt.Errorf("[%d]: %w", idx, err)
+			}
+		}
+	case reflect.Map:
+		if !mayHoldStructs(value.Type().Elem()) {
+			return nil
+		}
+		iter := value.MapRange()
+		for iter.Next() {
+			key, elem := iter.Key(), iter.Value()
+			err := walk.collectCopy(elem, func(v reflect.Value) { value.SetMapIndex(key, v) })
+			if err != nil {
+				return fmt.Errorf("[%v]: %w", key, err)
+			}
+		}
+	}
+	return nil
+}
+
+// collectCopy collects from an addressable copy of `value`, which `store`
+// receives after processing.
+func (walk *fieldWalk) collectCopy(value reflect.Value, store func(reflect.Value)) error {
+	addressable := reflect.New(value.Type()).Elem()
+	addressable.Set(value)
+	before := len(walk.fields)
+	if err := walk.collectNested(addressable); err != nil {
+		return err
+	}
+	if len(walk.fields) > before {
+		walk.writeBack = append(walk.writeBack, func() { store(addressable) })
+	}
+	return nil
+}
+
+// mayHoldStructs reports whether values of type `t` may contain structs
+// to descend into.
+func mayHoldStructs(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Struct, reflect.Ptr, reflect.Interface, reflect.Slice, reflect.Array, reflect.Map:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,176 @@
+package crypto
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fieldsAddress struct {
+	Street string `crypt:"pii"`
+	City   string
+}
+
+type fieldsUser struct {
+	Id          string
+	EMail       string `crypt:"pii"`
+	Name        string `crypt:"pii"`
+	Secret      []byte `crypt:"pii"`
+	Skipped     string `crypt:"-"`
+	Disabled    bool
+	Permissions []string
+	Address     *fieldsAddress
+}
+
+func TestEncryptDecryptFields(t *testing.T) {
+	req := require.New(t)
+
+	k, err := NewKey()
+	req.NoError(err, "key creation should succeed")
+
+	orig := fieldsUser{
+		Id:          "u-1",
+		EMail:       "jane@example.com",
+		Name:        "Jane Doe",
+		Secret:      []byte{0, 1, 2, 3},
+		Skipped:     "visible",
+		Permissions: []string{"read"},
+		Address:     &fieldsAddress{Street: "Main Street 1", City: "Berlin"},
+	}
+	user := orig
+	user.Address = &fieldsAddress{Street: orig.Address.Street, City: orig.Address.City}
+
+	req.NoError(EncryptFields(k, &user), "encrypting fields should succeed")
+	req.Equal(orig.Id, user.Id)
+	req.Equal(orig.Skipped, user.Skipped)
+	req.Equal(orig.Address.City, user.Address.City)
+	req.NotEqual(orig.EMail, user.EMail)
+	req.NotEqual(orig.Secret, user.Secret)
+	req.NotEqual(orig.Address.Street, user.Address.Street)
+
+	req.NoError(DecryptFields(k, &user), "decrypting fields should succeed")
+	req.Equal(orig, user)
+}
+
+func TestEncryptFieldsRejectsNonStruct(t *testing.T) {
+	req := require.New(t)
+
+	k, err := NewKey()
+	req.NoError(err, "key creation should succeed")
+
+	req.Error(EncryptFields(k, fieldsUser{}), "non-pointer should be rejected")
+
+	bad := struct {
+		Count int `crypt:"pii"`
+	}{}
+	req.Error(EncryptFields(k, &bad), "unsupported field type should be rejected")
+}
+
+func TestEncryptFieldsLeavesStructUnchangedOnError(t *testing.T) {
+	req := require.New(t)
+
+	k, err := NewKey()
+	req.NoError(err, "key creation should succeed")
+
+	bad := struct {
+		EMail string `crypt:"pii"`
+		Count int    `crypt:"pii"`
+	}{EMail: "jane@example.com"}
+	req.Error(EncryptFields(k, &bad), "unsupported field type should be rejected")
+	req.Equal("jane@example.com", bad.EMail, "valid fields should not be encrypted")
+}
+
+type fieldsNode struct {
+	Name string `crypt:"pii"`
+	Next *fieldsNode
+}
+
+func TestEncryptFieldsCycle(t *testing.T) {
+	req := require.New(t)
+
+	k, err := NewKey()
+	req.NoError(err, "key creation should succeed")
+
+	first := &fieldsNode{Name: "first"}
+	first.Next = &fieldsNode{Name: "second", Next: first}
+
+	req.NoError(EncryptFields(k, first), "encrypting a cycle should succeed")
+	req.NotEqual("first", first.Name)
+	req.NotEqual("second", first.Next.Name)
+
+	req.NoError(DecryptFields(k, first), "decrypting a cycle should succeed")
+	req.Equal("first", first.Name, "node should be encrypted once")
+	req.Equal("second", first.Next.Name, "node should be encrypted once")
+}
+
+func TestDecryptFieldsRejectsSwappedValues(t *testing.T) {
+	req := require.New(t)
+
+	k, err := NewKey()
+	req.NoError(err, "key creation should succeed")
+
+	user := fieldsUser{EMail: "jane@example.com", Name: "Jane Doe"}
+	req.NoError(EncryptFields(k, &user), "encrypting fields should succeed")
+	user.EMail, user.Name = user.Name, user.EMail
+
+	err = DecryptFields(k, &user)
+	req.ErrorIs(err, ErrAuthFailed, "values moved between fields should fail to decrypt")
+}
+
+type fieldsContacts struct {
+	List     []fieldsAddress
+	Pointers []*fieldsAddress
+	Fixed    [1]fieldsAddress
+	ByName   map[string]fieldsAddress
+	Any      interface{}
+	Excluded fieldsAddress `crypt:"-"`
+}
+
+func TestEncryptFieldsCollections(t *testing.T) {
+	req := require.New(t)
+
+	k, err := NewKey()
+	req.NoError(err, "key creation should succeed")
+
+	contacts := fieldsContacts{
+		List:     []fieldsAddress{{Street: "list"}},
+		Pointers: []*fieldsAddress{{Street: "pointer"}},
+		Fixed:    [1]fieldsAddress{{Street: "array"}},
+		ByName:   map[string]fieldsAddress{"home": {Street: "map"}},
+		Any:      fieldsAddress{Street: "interface"},
+		Excluded: fieldsAddress{Street: "excluded"},
+	}
+	req.NoError(EncryptFields(k, &contacts), "encrypting fields should succeed")
+	for _, street := range []string{
+		contacts.List[0].Street, contacts.Pointers[0].Street, contacts.Fixed[0].Street,
+		contacts.ByName["home"].Street, contacts.Any.(fieldsAddress).Street,
+	} {
+		req.NotContains([]string{"list", "pointer", "array", "map", "interface"}, street, "nested field should be encrypted")
+	}
+	req.Equal("excluded", contacts.Excluded.Street, "fields tagged with - should be skipped with all nested fields")
+
+	req.NoError(DecryptFields(k, &contacts), "decrypting fields should succeed")
+	req.Equal("list", contacts.List[0].Street)
+	req.Equal("pointer", contacts.Pointers[0].Street)
+	req.Equal("array", contacts.Fixed[0].Street)
+	req.Equal("map", contacts.ByName["home"].Street)
+	req.Equal("interface", contacts.Any.(fieldsAddress).Street)
+}
+
+func TestEncryptFieldsEmptyValue(t *testing.T) {
+	req := require.New(t)
+
+	k, err := NewKey()
+	req.NoError(err, "key creation should succeed")
+	other, err := NewKey()
+	req.NoError(err, "key creation should succeed")
+
+	user := fieldsUser{EMail: "", Name: "Jane Doe"}
+	req.NoError(EncryptFields(k, &user), "encrypting fields should succeed")
+	req.NotEmpty(user.EMail, "empty values should be sealed as well")
+
+	moved := user
+	moved.Name = user.EMail
+	req.ErrorIs(DecryptFields(k, &moved), ErrAuthFailed, "empty values should be bound to their field")
+	req.ErrorIs(DecryptFields(other, &user), ErrAuthFailed, "empty values should be bound to their key")
+}
@@ -0,0 +1,85 @@
+package crypto
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// SealFile seals the content of file `src` into file `dst` using
+// `ChachaSealFromReaderWithOptions`, so the cipher text ends with an
+// authenticated trailer. `dst` is replaced atomically: it either keeps
+// its previous state or holds the complete cipher text.
+func SealFile(key *Key, src, dst string) error {
+	return transformFile(src, dst, func(r io.Reader, w io.Writer) error {
+		_, err := key.ChachaSealFromReaderWithOptions(context.Background(), r, w, SealOptions{})
+		return err
+	})
+}
+
+// OpenFile opens the cipher text in file `src` into file `dst` using
+// `ChachaOpenFromReaderWithOptions`. The plain text is written to a
+// temporary file next to `dst` that is only renamed to `dst` once the
+// whole stream has been authenticated and verified against its trailer,
+// so a tampered or truncated `src` never leaves (partial) plain text
+// behind. Streams without trailer, which cannot be told apart from
+// truncated ones, fail with `ErrAuthFailed`.
+func OpenFile(key *Key, src, dst string) error {
+	return transformFile(src, dst, func(r io.Reader, w io.Writer) error {
+		result, err := key.ChachaOpenFromReaderWithOptions(context.Background(), r, w, OpenOptions{})
+		if err != nil {
+			return err
+		}
+		if !result.Verified {
+			return fmt.Errorf("%w: stream has no trailer", ErrAuthFailed)
+		}
+		return nil
+	})
+}
+
+func transformFile(src, dst string, fn func(io.Reader, io.Writer) error) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open source: %w", err)
+	}
+	defer in.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if err := fn(in, tmp); err != nil {
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		return fmt.Errorf("failed to sync temporary file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close temporary file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), dst); err != nil {
+		return fmt.Errorf("failed to rename temporary file: %w", err)
+	}
+	committed = true
+
+	// persist the rename itself
+	dir, err := os.Open(filepath.Dir(dst))
+	if err != nil {
+		return fmt.Errorf("failed to open target directory: %w", err)
+	}
+	defer dir.Close()
+	if err := dir.Sync(); err != nil {
+		return fmt.Errorf("failed to sync target directory: %w", err)
+	}
+	return nil
+}
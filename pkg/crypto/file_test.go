@@ -0,0 +1,70 @@
+package crypto
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSealOpenFile(t *testing.T) {
+	req := require.New(t)
+	dir := t.TempDir()
+
+	k, err := NewKey()
+	req.NoError(err, "key creation should succeed")
+
+	plainPath := filepath.Join(dir, "plain.txt")
+	sealedPath := filepath.Join(dir, "plain.txt.sealed")
+	openedPath := filepath.Join(dir, "opened.txt")
+	req.NoError(os.WriteFile(plainPath, []byte("Hello World"), 0600))
+
+	req.NoError(SealFile(k, plainPath, sealedPath), "sealing file should succeed")
+	req.NoError(OpenFile(k, sealedPath, openedPath), "opening file should succeed")
+	opened, err := os.ReadFile(openedPath)
+	req.NoError(err)
+	req.Equal("Hello World", string(opened))
+
+	// a tampered file must neither leave plain text nor temporary files
+	sealed, err := os.ReadFile(sealedPath)
+	req.NoError(err)
+	sealed[len(sealed)-9] ^= 1
+	req.NoError(os.WriteFile(sealedPath, sealed, 0600))
+	req.NoError(os.Remove(openedPath))
+
+	err = OpenFile(k, sealedPath, openedPath)
+	req.ErrorIs(err, ErrAuthFailed)
+	entries, err := os.ReadDir(dir)
+	req.NoError(err)
+	req.Len(entries, 2, "only source files should remain")
+}
+
+func TestOpenFileRequiresTrailer(t *testing.T) {
+	req := require.New(t)
+	dir := t.TempDir()
+
+	k, err := NewKey()
+	req.NoError(err, "key creation should succeed")
+
+	// a lone terminator authenticates as empty legacy stream
+	sealedPath := filepath.Join(dir, "truncated.sealed")
+	openedPath := filepath.Join(dir, "opened.txt")
+	req.NoError(os.WriteFile(sealedPath, make([]byte, 8), 0600))
+
+	err = OpenFile(k, sealedPath, openedPath)
+	req.ErrorIs(err, ErrAuthFailed)
+	_, err = os.Stat(openedPath)
+	req.True(os.IsNotExist(err), "no plain text should be left behind")
+
+	// cutting off the trailer fails as well
+	plainPath := filepath.Join(dir, "plain.txt")
+	req.NoError(os.WriteFile(plainPath, []byte("Hello World"), 0600))
+	req.NoError(SealFile(k, plainPath, sealedPath), "sealing file should succeed")
+	sealed, err := os.ReadFile(sealedPath)
+	req.NoError(err)
+	withoutTrailer := append(sealed[:streamHeaderSize+8+nonceSize+len("Hello World")+16], make([]byte, 8)...)
+	req.NoError(os.WriteFile(sealedPath, withoutTrailer, 0600))
+	err = OpenFile(k, sealedPath, openedPath)
+	req.ErrorIs(err, ErrTruncated)
+}
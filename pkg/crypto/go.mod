@@ -1,6 +1,6 @@
 module github.com/paraopsde/go-x/pkg/crypto
 
-go 1.21
+go 1.24
 
 require (
 	github.com/kevinburke/nacl v0.0.0-20210405173606-cd9060f5f776
@@ -0,0 +1,161 @@
+package crypto
+
+import (
+	"crypto/ecdh"
+	"crypto/sha3"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// KEM names the key encapsulation mechanism used to seal a symmetric key.
+// It is recorded in the sealed envelope.
+type KEM string
+
+const (
+	// KEMX25519 seals with a NaCl box (X25519), as `SealSymKey` does.
+	KEMX25519 KEM = "x25519"
+	// KEMX25519MLKEM768 combines an ephemeral X25519 exchange with an
+	// encapsulation to the independent ML-KEM-768 key of the holder, so
+	// the sealed key stays protected as long as either of them is
+	// unbroken. It guards archives against "harvest now, decrypt later"
+	// attacks by future quantum computers.
+	KEMX25519MLKEM768 KEM = "x25519-mlkem768"
+)
+
+const hybridKEKDomain = "go-x/crypto x25519-mlkem768 kek v1\x00"
+
+// SealSymKeyWithKEM seals `symkey` for this key pair using the given KEM.
+//
+// `KEMX25519MLKEM768` requires the key pair to have an ML-KEM-768 key,
+// as created by `NewKeyPairWithMLKEM` or added with `AddMLKEMKey`. Only
+// the public keys are used, so `akey` may come from `NewPublicKeyFromHex`.
+func (akey *AsymKey) SealSymKeyWithKEM(symkey *Key, kem KEM) (string, error) {
+	switch kem {
+	case KEMX25519:
+		return akey.SealSymKey(symkey)
+	case KEMX25519MLKEM768:
+		return akey.sealHybrid(symkey)
+	}
+	return "", fmt.Errorf("%w: kem %q", ErrUnknownFormat, kem)
+}
+
+func (akey *AsymKey) sealHybrid(symkey *Key) (string, error) {
+	holderX, err := ecdh.X25519().NewPublicKey(akey.public[:])
+	if err != nil {
+		return "", fmt.Errorf("%w: holder: %w", ErrBadKeyLength, err)
+	}
+	ephemeral, err := ecdh.X25519().GenerateKey(randReader)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrEntropy, err)
+	}
+	sharedX, err := ephemeral.ECDH(holderX)
+	if err != nil {
+		return "", fmt.Errorf("failed to exchange x25519: %w", err)
+	}
+
+	if akey.mlkemPublic == nil {
+		return "", ErrMissingMLKEM
+	}
+	sharedM, cipherM := akey.mlkemPublic.Encapsulate()
+
+	kek := hybridKEK(sharedM, sharedX, cipherM, ephemeral.PublicKey().Bytes(), akey.public[:])
+	cipher, err := sealWithKEK(kek, symkey.bytes[:])
+	if err != nil {
+		return "", err
+	}
+
+	sealmap := map[string]string{
+		"kem":       string(KEMX25519MLKEM768),
+		"holder":    akey.PublicHex(),
+		"ephemeral": hex.EncodeToString(ephemeral.PublicKey().Bytes()),
+		"mlkem":     base64.StdEncoding.EncodeToString(cipherM),
+		"cipher":    base64.StdEncoding.EncodeToString(cipher),
+	}
+	sealedJson, err := json.Marshal(sealmap)
+	if err != nil {
+		return "", fmt.Errorf("failed to json-marshal: %w", err)
+	}
+	return string(sealedJson), nil
+}
+
+func (akey *AsymKey) openHybrid(sealmap map[string]string) (*Key, error) {
+	ephemeralBytes, err := hex.DecodeString(sealmap["ephemeral"])
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to decode ephemeral: %w", ErrUnknownFormat, err)
+	}
+	cipherM, err := base64.StdEncoding.DecodeString(sealmap["mlkem"])
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to base64 decode mlkem: %w", ErrUnknownFormat, err)
+	}
+	cipher, err := base64.StdEncoding.DecodeString(sealmap["cipher"])
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to base64 decode cipher: %w", ErrUnknownFormat, err)
+	}
+
+	ephemeral, err := ecdh.X25519().NewPublicKey(ephemeralBytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: ephemeral: %w", ErrBadKeyLength, err)
+	}
+	holderX, err := ecdh.X25519().NewPrivateKey(akey.private[:])
+	if err != nil {
+		return nil, fmt.Errorf("%w: holder: %w", ErrBadKeyLength, err)
+	}
+	sharedX, err := holderX.ECDH(ephemeral)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to exchange x25519: %w", ErrAuthFailed, err)
+	}
+
+	if akey.mlkem == nil {
+		return nil, ErrMissingMLKEM
+	}
+	sharedM, err := akey.mlkem.Decapsulate(cipherM)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to decapsulate: %w", ErrUnknownFormat, err)
+	}
+
+	kek := hybridKEK(sharedM, sharedX, cipherM, ephemeralBytes, akey.public[:])
+	plainBytes, err := openWithKEK(kek, cipher)
+	if err != nil {
+		return nil, err
+	}
+	return NewKeyFromBytes(plainBytes)
+}
+
+// hybridKEK combines both shared secrets into a key encryption key,
+// binding it to the cipher texts and public keys of the exchange.
+func hybridKEK(sharedM, sharedX, cipherM, ephemeralX, holderX []byte) []byte {
+	h := sha3.New256()
+	h.Write([]byte(hybridKEKDomain))
+	h.Write(sharedM)
+	h.Write(sharedX)
+	h.Write(cipherM)
+	h.Write(ephemeralX)
+	h.Write(holderX)
+	return h.Sum(nil)
+}
+
+// sealWithKEK encrypts `plain` with a single use key encryption key. As
+// the key is never reused, a zero nonce is safe.
+func sealWithKEK(kek, plain []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.New(kek)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to create aead: %w", ErrBadKeyLength, err)
+	}
+	return aead.Seal(nil, make([]byte, nonceSize), plain, nil), nil
+}
+
+func openWithKEK(kek, cipher []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.New(kek)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to create aead: %w", ErrBadKeyLength, err)
+	}
+	plain, err := aead.Open(nil, make([]byte, nonceSize), cipher, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to decrypt: %w", ErrAuthFailed, err)
+	}
+	return plain, nil
+}
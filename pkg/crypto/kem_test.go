@@ -0,0 +1,142 @@
+package crypto
+
+import (
+	crand "crypto/rand"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSealOpenSymKeyWithKEM(t *testing.T) {
+	req := require.New(t)
+
+	k, err := NewKey()
+	req.NoError(err, "key creation should succeed")
+	akey, err := NewKeyPairWithMLKEM()
+	req.NoError(err, "key pair creation should succeed")
+	restored, err := NewKeyPairFromPrivateHex(akey.PrivateHex())
+	req.NoError(err, "key pair restore should succeed")
+
+	for _, kem := range []KEM{KEMX25519, KEMX25519MLKEM768} {
+		sealed, err := akey.SealSymKeyWithKEM(k, kem)
+		req.NoError(err, "sealing with %s should succeed", kem)
+
+		sealmap := map[string]string{}
+		req.NoError(json.Unmarshal([]byte(sealed), &sealmap))
+		req.Equal(string(kem), sealmap["kem"])
+
+		opened, err := restored.OpenSymKey(sealed)
+		req.NoError(err, "opening with %s should succeed", kem)
+		req.True(k.Equal(opened))
+
+		_, err = NewKeyPair().OpenSymKey(sealed)
+		req.ErrorIs(err, ErrWrongHolder)
+	}
+
+	_, err = akey.SealSymKeyWithKEM(k, "rsa")
+	req.ErrorIs(err, ErrUnknownFormat)
+}
+
+func TestOpenSymKeyHybridTampered(t *testing.T) {
+	req := require.New(t)
+
+	k, err := NewKey()
+	req.NoError(err, "key creation should succeed")
+	akey, err := NewKeyPairWithMLKEM()
+	req.NoError(err, "key pair creation should succeed")
+
+	sealed, err := akey.SealSymKeyWithKEM(k, KEMX25519MLKEM768)
+	req.NoError(err, "sealing should succeed")
+	other, err := akey.SealSymKeyWithKEM(k, KEMX25519MLKEM768)
+	req.NoError(err, "sealing should succeed")
+
+	sealmap := map[string]string{}
+	req.NoError(json.Unmarshal([]byte(sealed), &sealmap))
+	othermap := map[string]string{}
+	req.NoError(json.Unmarshal([]byte(other), &othermap))
+
+	// mixing parts of two envelopes must not open
+	sealmap["mlkem"] = othermap["mlkem"]
+	mixed, err := json.Marshal(sealmap)
+	req.NoError(err)
+	_, err = akey.OpenSymKey(string(mixed))
+	req.ErrorIs(err, ErrAuthFailed)
+}
+
+func TestHybridMLKEMKeyIsIndependent(t *testing.T) {
+	req := require.New(t)
+
+	k, err := NewKey()
+	req.NoError(err, "key creation should succeed")
+	req.Len(NewKeyPair().PrivateHex(), 2*asymKeySize, "default key pairs should be x25519 only")
+	akey, err := NewKeyPairWithMLKEM()
+	req.NoError(err, "key pair creation should succeed")
+	req.Len(akey.PrivateHex(), 2*(asymKeySize+64), "private hex should include the mlkem seed")
+
+	sealed, err := akey.SealSymKeyWithKEM(k, KEMX25519MLKEM768)
+	req.NoError(err, "sealing should succeed")
+
+	// the x25519 private key alone must not suffice to open
+	legacy, err := NewKeyPairFromPrivateHex(akey.PrivateHex()[:2*asymKeySize])
+	req.NoError(err, "legacy key pair restore should succeed")
+	_, err = legacy.OpenSymKey(sealed)
+	req.ErrorIs(err, ErrMissingMLKEM)
+	_, err = legacy.SealSymKeyWithKEM(k, KEMX25519MLKEM768)
+	req.ErrorIs(err, ErrMissingMLKEM)
+
+	req.NoError(legacy.AddMLKEMKey(), "adding an mlkem key should succeed")
+	_, err = legacy.OpenSymKey(sealed)
+	req.ErrorIs(err, ErrAuthFailed)
+
+	resealed, err := legacy.SealSymKeyWithKEM(k, KEMX25519MLKEM768)
+	req.NoError(err, "sealing after adding an mlkem key should succeed")
+	restored, err := NewKeyPairFromPrivateHex(legacy.PrivateHex())
+	req.NoError(err, "key pair restore should succeed")
+	opened, err := restored.OpenSymKey(resealed)
+	req.NoError(err, "opening should succeed")
+	req.True(k.Equal(opened))
+
+	_, err = NewKeyPairFromPrivateHex("0011")
+	req.ErrorIs(err, ErrBadKeyLength)
+
+	randReader = failingReader{}
+	defer func() { randReader = crand.Reader }()
+	_, err = NewKeyPairWithMLKEM()
+	req.ErrorIs(err, ErrEntropy)
+	_, err = akey.SealSymKey(k)
+	req.ErrorIs(err, ErrEntropy)
+}
+
+func TestSealSymKeyWithPublicKey(t *testing.T) {
+	req := require.New(t)
+
+	k, err := NewKey()
+	req.NoError(err, "key creation should succeed")
+	akey, err := NewKeyPairWithMLKEM()
+	req.NoError(err, "key pair creation should succeed")
+	public, err := NewPublicKeyFromHex(akey.PublicHex(), akey.MLKEMPublicHex())
+	req.NoError(err, "public key load should succeed")
+	req.Empty(public.PrivateHex())
+
+	for _, kem := range []KEM{KEMX25519, KEMX25519MLKEM768} {
+		sealed, err := public.SealSymKeyWithKEM(k, kem)
+		req.NoError(err, "sealing with %s should succeed", kem)
+
+		opened, err := akey.OpenSymKey(sealed)
+		req.NoError(err, "opening with %s should succeed", kem)
+		req.True(k.Equal(opened))
+
+		_, err = public.OpenSymKey(sealed)
+		req.ErrorIs(err, ErrPublicKeyOnly)
+	}
+
+	x25519Only, err := NewPublicKeyFromHex(akey.PublicHex(), "")
+	req.NoError(err, "public key load should succeed")
+	_, err = x25519Only.SealSymKeyWithKEM(k, KEMX25519MLKEM768)
+	req.ErrorIs(err, ErrMissingMLKEM)
+	req.ErrorIs(x25519Only.AddMLKEMKey(), ErrPublicKeyOnly)
+
+	_, err = NewPublicKeyFromHex(akey.PublicHex(), "0011")
+	req.ErrorIs(err, ErrUnknownFormat)
+}
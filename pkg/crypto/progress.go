@@ -0,0 +1,84 @@
+package crypto
+
+import (
+	"context"
+	"fmt"
+)
+
+// Progress describes how far a seal or open operation has come. Bytes
+// counts the plain text of the chunks processed so far, which is the
+// compressed plain text for streams sealed with compression.
+type Progress struct {
+	Chunks int64
+	Bytes  int64
+}
+
+// Counter is a monotonic counter as implemented by prometheus.Counter.
+type Counter interface {
+	Add(float64)
+}
+
+// Metrics holds optional counters that are updated by seal and open
+// operations. Any of them may be nil.
+type Metrics struct {
+	BytesSealed  Counter
+	BytesOpened  Counter
+	AuthFailures Counter
+}
+
+// chunkObserver is notified after every chunk of a stream and stops the
+// stream once its context is done. A nil observer does nothing.
+type chunkObserver struct {
+	ctx      context.Context
+	progress func(Progress)
+	bytes    Counter
+	state    Progress
+}
+
+func newChunkObserver(ctx context.Context, progress func(Progress), bytes Counter) *chunkObserver {
+	return &chunkObserver{ctx: ctx, progress: progress, bytes: bytes}
+}
+
+func (obs *chunkObserver) canceled() error {
+	if obs == nil {
+		return nil
+	}
+	if err := obs.ctx.Err(); err != nil {
+		return fmt.Errorf("stopped after %d chunks: %w", obs.state.Chunks, err)
+	}
+	return nil
+}
+
+func (obs *chunkObserver) chunkDone(plainBytes int) {
+	if obs == nil {
+		return
+	}
+	obs.state.Chunks++
+	obs.state.Bytes += int64(plainBytes)
+	if obs.bytes != nil {
+		obs.bytes.Add(float64(plainBytes))
+	}
+	if obs.progress != nil {
+		obs.progress(obs.state)
+	}
+}
+
+func (m *Metrics) bytesSealed() Counter {
+	if m == nil {
+		return nil
+	}
+	return m.BytesSealed
+}
+
+func (m *Metrics) bytesOpened() Counter {
+	if m == nil {
+		return nil
+	}
+	return m.BytesOpened
+}
+
+func (m *Metrics) authFailed() {
+	if m != nil && m.AuthFailures != nil {
+		m.AuthFailures.Add(1)
+	}
+}
@@ -0,0 +1,66 @@
+package crypto
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testCounter struct {
+	value float64
+}
+
+func (c *testCounter) Add(v float64) {
+	c.value += v
+}
+
+func TestProgressAndMetrics(t *testing.T) {
+	req := require.New(t)
+
+	k, err := NewKey()
+	req.NoError(err, "key creation should succeed")
+	metrics := &Metrics{BytesSealed: &testCounter{}, BytesOpened: &testCounter{}, AuthFailures: &testCounter{}}
+
+	infile := make([]byte, 2*chunkSize+1)
+	var (
+		cipher   bytes.Buffer
+		progress []Progress
+	)
+	_, err = k.ChachaSealFromReaderWithOptions(context.Background(), bytes.NewReader(infile), &cipher, SealOptions{
+		Progress: func(p Progress) { progress = append(progress, p) },
+		Metrics:  metrics,
+	})
+	req.NoError(err, "chacha seal should succeed")
+	req.Equal([]Progress{{1, int64(chunkSize)}, {2, int64(2 * chunkSize)}, {3, int64(len(infile))}}, progress)
+	req.Equal(float64(len(infile)), metrics.BytesSealed.(*testCounter).value)
+
+	_, err = k.ChachaOpenFromReaderWithOptions(context.Background(), bytes.NewReader(cipher.Bytes()), io.Discard, OpenOptions{Metrics: metrics})
+	req.NoError(err, "chacha open should succeed")
+	req.Equal(float64(len(infile)), metrics.BytesOpened.(*testCounter).value)
+
+	tampered := cipher.Bytes()
+	tampered[streamHeaderSize+8+nonceSize] ^= 1
+	_, err = k.ChachaOpenFromReaderWithOptions(context.Background(), bytes.NewReader(tampered), io.Discard, OpenOptions{Metrics: metrics})
+	req.ErrorIs(err, ErrAuthFailed)
+	req.Equal(float64(1), metrics.AuthFailures.(*testCounter).value)
+}
+
+func TestSealCancel(t *testing.T) {
+	req := require.New(t)
+
+	k, err := NewKey()
+	req.NoError(err, "key creation should succeed")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err = k.ChachaSealFromReaderWithOptions(ctx, bytes.NewReader(make([]byte, 3*chunkSize)), io.Discard, SealOptions{
+		Progress: func(p Progress) {
+			if p.Chunks == 1 {
+				cancel()
+			}
+		},
+	})
+	req.ErrorIs(err, context.Canceled)
+}
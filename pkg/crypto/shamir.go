@@ -0,0 +1,230 @@
+package crypto
+
+import (
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Share is one part of a key split by `SplitKey`.
+type Share struct {
+	// Index is the x coordinate of the share, 1..255.
+	Index byte
+	// Threshold is the number of shares needed to reconstruct the key.
+	Threshold byte
+	// Value holds one y coordinate per byte of the key.
+	Value []byte
+}
+
+// SplitKey splits `key` into `n` shares using Shamir's secret sharing
+// over GF(2^8), so that any `k` of them reconstruct the key with
+// `CombineShares` while fewer reveal nothing about it.
+func SplitKey(key *Key, n, k int) ([]Share, error) {
+	if k < 2 || k > n || n > 255 {
+		return nil, fmt.Errorf("%w: need 2 <= k (%d) <= n (%d) <= 255", ErrInvalidShares, k, n)
+	}
+
+	shares := make([]Share, n)
+	for idx := range shares {
+		shares[idx] = Share{Index: byte(idx + 1), Threshold: byte(k), Value: make([]byte, keySize)}
+	}
+	coeffs := make([]byte, k)
+	defer wipe(coeffs)
+	for pos, secret := range key.bytes {
+		// random polynomial of degree k-1 with the secret as constant term
+		coeffs[0] = secret
+		if _, err := io.ReadFull(randReader, coeffs[1:]); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrEntropy, err)
+		}
+		for idx := range shares {
+			shares[idx].Value[pos] = gfEval(coeffs, shares[idx].Index)
+		}
+	}
+	return shares, nil
+}
+
+// CombineShares reconstructs a key from at least `Threshold` distinct
+// shares produced by `SplitKey`. All shares are checked; shares beyond
+// the threshold must lie on the same polynomial, so a corrupted share
+// fails with `ErrInvalidShares` instead of yielding a wrong key.
+func CombineShares(shares []Share) (*Key, error) {
+	if len(shares) == 0 {
+		return nil, fmt.Errorf("%w: no shares", ErrInvalidShares)
+	}
+	threshold := int(shares[0].Threshold)
+	seen := map[byte]bool{}
+	for _, share := range shares {
+		if err := share.validate(); err != nil {
+			return nil, err
+		}
+		if seen[share.Index] {
+			return nil, fmt.Errorf("%w: duplicate index %d", ErrInvalidShares, share.Index)
+		}
+		if int(share.Threshold) != threshold {
+			return nil, fmt.Errorf("%w: share %d does not match the others", ErrInvalidShares, share.Index)
+		}
+		seen[share.Index] = true
+	}
+	if len(shares) < threshold {
+		return nil, fmt.Errorf("%w: got %d shares, need %d", ErrInvalidShares, len(shares), threshold)
+	}
+
+	base := shares[:threshold]
+	for _, extra := range shares[threshold:] {
+		value := interpolate(base, extra.Index)
+		consistent := subtle.ConstantTimeCompare(value, extra.Value) == 1
+		wipe(value)
+		if !consistent {
+			return nil, fmt.Errorf("%w: share %d does not match the others", ErrInvalidShares, extra.Index)
+		}
+	}
+	keybytes := interpolate(base, 0)
+	defer wipe(keybytes)
+	return NewKeyFromBytes(keybytes)
+}
+
+// interpolate evaluates the polynomial through `shares` at `x` using
+// Lagrange interpolation.
+func interpolate(shares []Share, x byte) []byte {
+	values := make([]byte, keySize)
+	for j, sj := range shares {
+		basis := byte(1)
+		for m, sm := range shares {
+			if m != j {
+				basis = gfMul(basis, gfMul(x^sm.Index, gfInv(sm.Index^sj.Index)))
+			}
+		}
+		for pos := range values {
+			values[pos] ^= gfMul(sj.Value[pos], basis)
+		}
+	}
+	return values
+}
+
+// validate checks the parameters of a single share.
+func (s Share) validate() error {
+	if s.Index == 0 {
+		return fmt.Errorf("%w: index 0", ErrInvalidShares)
+	}
+	if s.Threshold < 2 {
+		return fmt.Errorf("%w: share %d has threshold %d", ErrInvalidShares, s.Index, s.Threshold)
+	}
+	if len(s.Value) != keySize {
+		return fmt.Errorf("%w: share %d has %d bytes", ErrInvalidShares, s.Index, len(s.Value))
+	}
+	return nil
+}
+
+// Hex encodes the share as hex string.
+func (s Share) Hex() string {
+	return hex.EncodeToString(s.bytes())
+}
+
+// NewShareFromHex decodes a share encoded by `Share.Hex`.
+func NewShareFromHex(hexstring string) (Share, error) {
+	raw, err := hex.DecodeString(hexstring)
+	if err != nil {
+		return Share{}, fmt.Errorf("%w: failed to decode hex: %w", ErrUnknownFormat, err)
+	}
+	return newShareFromBytes(raw)
+}
+
+// SealShare seals `share` for the custodian owning the X25519 public key
+// `custodianPublicHex` (see `AsymKey.PublicHex`). Only the custodian can
+// open it using `AsymKey.OpenShare`.
+func SealShare(share Share, custodianPublicHex string) (string, error) {
+	raw := share.bytes()
+	defer wipe(raw)
+	sealmap, err := sealToPublic(custodianPublicHex, raw)
+	if err != nil {
+		return "", err
+	}
+	sealmap["type"] = "share"
+	sealedJson, err := json.Marshal(sealmap)
+	if err != nil {
+		return "", fmt.Errorf("failed to json-marshal: %w", err)
+	}
+	return string(sealedJson), nil
+}
+
+// OpenShare opens a share sealed for this key pair by `SealShare`.
+func (akey *AsymKey) OpenShare(sealed string) (Share, error) {
+	sealmap, err := akey.unmarshalSealed(sealed)
+	if err != nil {
+		return Share{}, err
+	}
+	if sealmap["type"] != "share" {
+		return Share{}, fmt.Errorf("%w: not a share", ErrUnknownFormat)
+	}
+	raw, err := akey.openBox(sealmap)
+	if err != nil {
+		return Share{}, err
+	}
+	return newShareFromBytes(raw)
+}
+
+func (s Share) bytes() []byte {
+	return append([]byte{s.Index, s.Threshold}, s.Value...)
+}
+
+func newShareFromBytes(raw []byte) (Share, error) {
+	if len(raw) != 2+keySize {
+		return Share{}, fmt.Errorf("%w: share has %d bytes", ErrUnknownFormat, len(raw))
+	}
+	share := Share{Index: raw[0], Threshold: raw[1], Value: append([]byte{}, raw[2:]...)}
+	if err := share.validate(); err != nil {
+		return Share{}, err
+	}
+	return share, nil
+}
+
+// String avoids leaking share material through logs.
+func (s Share) String() string {
+	return fmt.Sprintf("share %d/%d", s.Index, s.Threshold)
+}
+
+// gfEval evaluates the polynomial with coefficients `coeffs` (constant
+// term first) at `x` using Horner's method.
+func gfEval(coeffs []byte, x byte) byte {
+	var y byte
+	for idx := len(coeffs) - 1; idx >= 0; idx-- {
+		y = gfMul(y, x) ^ coeffs[idx]
+	}
+	return y
+}
+
+// gfMul multiplies in GF(2^8) modulo x^8 + x^4 + x^3 + x + 1 without
+// data dependent branches or table lookups.
+func gfMul(a, b byte) byte {
+	var p byte
+	for i := 0; i < 8; i++ {
+		p ^= -(b & 1) & a
+		hi := a >> 7
+		a = (a << 1) ^ (-hi & 0x1b)
+		b >>= 1
+	}
+	return p
+}
+
+// gfInv returns the multiplicative inverse as a^254.
+func gfInv(a byte) byte {
+	b := gfMul(a, a) // a^2
+	c := gfMul(a, b) // a^3
+	b = gfMul(c, c)  // a^6
+	b = gfMul(b, b)  // a^12
+	c = gfMul(b, c)  // a^15
+	b = gfMul(b, b)  // a^24
+	b = gfMul(b, b)  // a^48
+	b = gfMul(b, c)  // a^63
+	b = gfMul(b, b)  // a^126
+	b = gfMul(a, b)  // a^127
+	return gfMul(b, b)
+}
+
+func wipe(b []byte) {
+	for idx := range b {
+		b[idx] = 0
+	}
+}
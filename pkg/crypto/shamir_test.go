@@ -0,0 +1,106 @@
+package crypto
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGFInverse(t *testing.T) {
+	for a := 1; a < 256; a++ {
+		if gfMul(byte(a), gfInv(byte(a))) != 1 {
+			t.Errorf("wrong inverse of %d", a)
+		}
+	}
+}
+
+func TestSplitCombineKey(t *testing.T) {
+	req := require.New(t)
+
+	k, err := NewKey()
+	req.NoError(err, "key creation should succeed")
+
+	shares, err := SplitKey(k, 5, 3)
+	req.NoError(err, "splitting should succeed")
+	req.Len(shares, 5)
+
+	for _, subset := range [][]int{{0, 1, 2}, {4, 2, 0}, {1, 3, 4}, {0, 1, 2, 3, 4}} {
+		var picked []Share
+		for _, idx := range subset {
+			picked = append(picked, shares[idx])
+		}
+		combined, err := CombineShares(picked)
+		req.NoError(err, "combining %v should succeed", subset)
+		req.True(k.Equal(combined), "combining %v should restore the key", subset)
+	}
+
+	_, err = CombineShares(shares[:2])
+	req.ErrorIs(err, ErrInvalidShares)
+	_, err = CombineShares([]Share{shares[0], shares[0], shares[1]})
+	req.ErrorIs(err, ErrInvalidShares)
+	_, err = SplitKey(k, 2, 3)
+	req.ErrorIs(err, ErrInvalidShares)
+
+	decoded, err := NewShareFromHex(shares[1].Hex())
+	req.NoError(err, "decoding share should succeed")
+	req.Equal(shares[1], decoded)
+	req.NotContains(shares[1].String(), shares[1].Hex())
+}
+
+func TestSealOpenShare(t *testing.T) {
+	req := require.New(t)
+
+	k, err := NewKey()
+	req.NoError(err, "key creation should succeed")
+	shares, err := SplitKey(k, 3, 2)
+	req.NoError(err, "splitting should succeed")
+
+	custodian := NewKeyPair()
+	sealed, err := SealShare(shares[0], custodian.PublicHex())
+	req.NoError(err, "sealing share should succeed")
+
+	opened, err := custodian.OpenShare(sealed)
+	req.NoError(err, "opening share should succeed")
+	req.Equal(shares[0], opened)
+
+	_, err = NewKeyPair().OpenShare(sealed)
+	req.ErrorIs(err, ErrWrongHolder)
+	_, err = custodian.OpenSymKey(sealed)
+	req.ErrorIs(err, ErrBadKeyLength)
+}
+
+func TestCombineSharesRejectsInvalidShares(t *testing.T) {
+	req := require.New(t)
+
+	k, err := NewKey()
+	req.NoError(err, "key creation should succeed")
+	shares, err := SplitKey(k, 4, 2)
+	req.NoError(err, "splitting should succeed")
+
+	for name, share := range map[string]Share{
+		"threshold 0": {Index: 1, Threshold: 0, Value: make([]byte, keySize)},
+		"threshold 1": {Index: 1, Threshold: 1, Value: shares[0].Value},
+		"index 0":     {Index: 0, Threshold: 2, Value: shares[0].Value},
+	} {
+		_, err = CombineShares([]Share{share})
+		req.ErrorIs(err, ErrInvalidShares, name)
+		_, err = CombineShares([]Share{share, shares[1]})
+		req.ErrorIs(err, ErrInvalidShares, name)
+		_, err = NewShareFromHex(share.Hex())
+		req.ErrorIs(err, ErrInvalidShares, name)
+	}
+
+	// shares beyond the threshold are checked as well
+	corrupted := Share{Index: shares[2].Index, Threshold: 2, Value: append([]byte{}, shares[2].Value...)}
+	corrupted.Value[0] ^= 1
+	_, err = CombineShares([]Share{shares[0], shares[1], corrupted})
+	req.ErrorIs(err, ErrInvalidShares)
+	_, err = CombineShares([]Share{shares[0], shares[1], {Index: 3, Threshold: 3, Value: shares[2].Value}})
+	req.ErrorIs(err, ErrInvalidShares)
+	_, err = CombineShares([]Share{shares[0], shares[1], {Index: 0, Threshold: 2, Value: shares[2].Value}})
+	req.ErrorIs(err, ErrInvalidShares)
+
+	combined, err := CombineShares(shares)
+	req.NoError(err, "combining all shares should succeed")
+	req.True(k.Equal(combined))
+}
@@ -0,0 +1,340 @@
+package crypto
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+)
+
+// Compression selects how plain text is compressed before sealing.
+type Compression byte
+
+const (
+	CompressionNone Compression = iota
+	CompressionGzip
+)
+
+// SealOptions control optional stages of `ChachaSealFromReaderWithOptions`.
+type SealOptions struct {
+	// Compression is applied to the plain text before it is sealed.
+	// Note that compression makes the cipher text length depend on the
+	// content of the plain text, so it must not be enabled for data that
+	// mixes secrets with attacker controlled input.
+	Compression Compression
+
+	// Progress, if set, is called after every sealed chunk.
+	Progress func(Progress)
+	// Metrics, if set, are updated with the bytes sealed.
+	Metrics *Metrics
+}
+
+// OpenOptions control optional behaviour of
+// `ChachaOpenFromReaderWithOptions`.
+type OpenOptions struct {
+	// Progress, if set, is called after every opened chunk.
+	Progress func(Progress)
+	// Metrics, if set, are updated with the bytes opened and
+	// authentication failures.
+	Metrics *Metrics
+}
+
+// StreamResult summarizes a sealed stream.
+type StreamResult struct {
+	// CipherBytes is the size of the sealed stream.
+	CipherBytes int64
+	// PlainBytes and PlainSHA256 describe the plain text (before
+	// compression). They are recorded in the authenticated trailer of
+	// the stream.
+	PlainBytes  int64
+	PlainSHA256 [sha256.Size]byte
+	// Verified is set by the opener if the stream had a trailer and the
+	// opened plain text matched it. Streams sealed without options have
+	// no trailer, their plain text is summarized nonetheless.
+	Verified bool
+}
+
+// A stream header is written in front of the chunks if the stream was
+// sealed with options. Its first 8 bytes never parse as a valid chunk
+// size, which keeps streams without header readable.
+//
+//	magic (7 bytes) | version (1 byte) | compression (1 byte) | flags (1 byte)
+//
+// With `flagTrailer` set, the last chunk before the terminating zero is
+// a trailer holding the plain text size and SHA-256:
+//
+//	size | trailerMarker (8 bytes) | nonce | sealed(plain size (8 bytes) | sha256)
+const (
+	streamMagic      = "GOXSEAL"
+	streamVersion    = 1
+	streamHeaderSize = len(streamMagic) + 3
+
+	flagTrailer   byte   = 1
+	trailerMarker uint64 = 1 << 63
+	trailerSize          = 8 + sha256.Size
+)
+
+type streamHeader struct {
+	compression Compression
+	flags       byte
+	// raw holds the encoded header, which is authenticated with every
+	// chunk so it cannot be altered.
+	raw []byte
+}
+
+func (c Compression) valid() bool {
+	return c == CompressionNone || c == CompressionGzip
+}
+
+func newStreamHeader(opts *SealOptions) (*streamHeader, error) {
+	if !opts.Compression.valid() {
+		return nil, fmt.Errorf("%w: compression %d", ErrUnknownFormat, opts.Compression)
+	}
+	hdr := &streamHeader{compression: opts.Compression, flags: flagTrailer}
+	hdr.raw = append([]byte(streamMagic), streamVersion, byte(hdr.compression), hdr.flags)
+	return hdr, nil
+}
+
+func isStreamHeader(first []byte) bool {
+	return bytes.HasPrefix(first, []byte(streamMagic))
+}
+
+// readStreamHeader parses a stream header of which the first 8 bytes
+// have already been read into `first`.
+func readStreamHeader(first []byte, cipherReader io.Reader) (*streamHeader, error) {
+	raw := make([]byte, streamHeaderSize)
+	copy(raw, first)
+	if _, err := io.ReadFull(cipherReader, raw[len(first):]); err != nil {
+		return nil, fmt.Errorf("failed to read stream header: %w", truncated(err))
+	}
+	if version := raw[len(streamMagic)]; version != streamVersion {
+		return nil, fmt.Errorf("%w: stream version %d", ErrUnknownFormat, version)
+	}
+	hdr := &streamHeader{
+		compression: Compression(raw[len(streamMagic)+1]),
+		flags:       raw[len(streamMagic)+2],
+		raw:         raw,
+	}
+	if !hdr.compression.valid() {
+		return nil, fmt.Errorf("%w: compression %d", ErrUnknownFormat, hdr.compression)
+	}
+	if hdr.flags&^flagTrailer != 0 {
+		return nil, fmt.Errorf("%w: flags %x", ErrUnknownFormat, hdr.flags)
+	}
+	return hdr, nil
+}
+
+// trailerAD derives the additional data of the trailer chunk from the
+// one of the other chunks, so a trailer cannot pass for a data chunk.
+func trailerAD(ad []byte) []byte {
+	return append(append([]byte{}, ad...), "trailer"...)
+}
+
+// plainDigest counts and hashes the plain text of a stream.
+type plainDigest struct {
+	hash hash.Hash
+	size int64
+}
+
+func newPlainDigest() *plainDigest {
+	return &plainDigest{hash: sha256.New()}
+}
+
+func (d *plainDigest) Write(p []byte) (int, error) {
+	d.hash.Write(p)
+	d.size += int64(len(p))
+	return len(p), nil
+}
+
+func (d *plainDigest) trailer() []byte {
+	buf := make([]byte, 8, trailerSize)
+	binary.BigEndian.PutUint64(buf, uint64(d.size))
+	return d.hash.Sum(buf)
+}
+
+func (d *plainDigest) result(cipherBytes int64) *StreamResult {
+	result := &StreamResult{CipherBytes: cipherBytes, PlainBytes: d.size}
+	d.hash.Sum(result.PlainSHA256[:0])
+	return result
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// ChachaOpenFromReaderWithOptions works like `ChachaOpenFromReader` and
+// additionally summarizes the opened stream. For streams with a trailer
+// the plain text is verified against it; a mismatch, e.g. due to chunks
+// being dropped or reordered, results in `ErrAuthFailed`. As plain text
+// is written before the trailer is read, callers must discard the output
+// on error (see `OpenFile`).
+// Opening stops with the error of `ctx` once it is done.
+func (key *Key) ChachaOpenFromReaderWithOptions(ctx context.Context, cipherReader io.Reader, plainWriter io.Writer, opts OpenOptions) (*StreamResult, error) {
+	obs := newChunkObserver(ctx, opts.Progress, opts.Metrics.bytesOpened())
+	result, err := key.openStream(cipherReader, plainWriter, obs)
+	if errors.Is(err, ErrAuthFailed) {
+		opts.Metrics.authFailed()
+	}
+	return result, err
+}
+
+func (key *Key) openStream(cipherReader io.Reader, plainWriter io.Writer, obs *chunkObserver) (*StreamResult, error) {
+	var (
+		counter = &countingReader{r: cipherReader}
+		digest  = newPlainDigest()
+		first   = make([]byte, 8)
+	)
+	plainWriter = io.MultiWriter(plainWriter, digest)
+	if _, err := io.ReadFull(counter, first); err != nil {
+		return nil, fmt.Errorf("failed to read stream start: %w", truncated(err))
+	}
+	if !isStreamHeader(first) {
+		// legacy stream, the first bytes are the size of the first chunk
+		if _, err := key.openChunks(io.MultiReader(bytes.NewReader(first), counter), plainWriter, nil, false, obs); err != nil {
+			return nil, err
+		}
+		return digest.result(counter.n), nil
+	}
+
+	hdr, err := readStreamHeader(first, counter)
+	if err != nil {
+		return nil, err
+	}
+	var trailer []byte
+	if hdr.compression == CompressionGzip {
+		gw := newGunzipWriter(plainWriter)
+		trailer, err = key.openChunks(counter, gw, hdr.raw, hdr.flags&flagTrailer != 0, obs)
+		if err != nil {
+			gw.Abort(err)
+		} else {
+			err = gw.Close()
+		}
+	} else {
+		trailer, err = key.openChunks(counter, plainWriter, hdr.raw, hdr.flags&flagTrailer != 0, obs)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := digest.result(counter.n)
+	if trailer != nil {
+		if !bytes.Equal(trailer, digest.trailer()) {
+			return nil, fmt.Errorf("%w: plain text does not match trailer", ErrAuthFailed)
+		}
+		result.Verified = true
+	}
+	return result, nil
+}
+
+// ChachaSealFromReaderWithOptions works like `ChachaSealFromReader` but
+// prefixes the chunks with a stream header recording `opts`, so that
+// `ChachaOpenFromReader` can reverse them. The header is authenticated
+// along with every chunk. The size and SHA-256 of the plain text are
+// written into an authenticated trailer and returned.
+// Sealing stops with the error of `ctx` once it is done.
+func (key *Key) ChachaSealFromReaderWithOptions(ctx context.Context, plainReader io.Reader, cipherWriter io.Writer, opts SealOptions) (*StreamResult, error) {
+	hdr, err := newStreamHeader(&opts)
+	if err != nil {
+		return nil, err
+	}
+	n, err := cipherWriter.Write(hdr.raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write stream header: %w", err)
+	}
+	if n != len(hdr.raw) {
+		return nil, fmt.Errorf("failed to write stream header: short write (%d)", n)
+	}
+
+	digest := newPlainDigest()
+	plainReader = io.TeeReader(plainReader, digest)
+
+	if hdr.compression == CompressionGzip {
+		compressed := newGzipReader(plainReader)
+		defer compressed.Close()
+		plainReader = compressed
+	}
+
+	obs := newChunkObserver(ctx, opts.Progress, opts.Metrics.bytesSealed())
+	bytesWritten, err := key.sealChunks(plainReader, cipherWriter, hdr.raw, digest.trailer, obs)
+	if err != nil {
+		return nil, err
+	}
+	return digest.result(int64(n) + bytesWritten), nil
+}
+
+// ChachaSealWithOptions is a variant of `ChachaSealFromReaderWithOptions`
+// that takes a slice of bytes instead of an io.Reader.
+func (key *Key) ChachaSealWithOptions(plain []byte, opts SealOptions) ([]byte, error) {
+	var cipher bytes.Buffer
+	if _, err := key.ChachaSealFromReaderWithOptions(context.Background(), bytes.NewReader(plain), &cipher, opts); err != nil {
+		return nil, fmt.Errorf("failed to seal: %w", err)
+	}
+	return cipher.Bytes(), nil
+}
+
+// newGzipReader returns a reader yielding the gzip compressed content of
+// `plainReader`. Closing it stops the compression.
+func newGzipReader(plainReader io.Reader) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		zw := gzip.NewWriter(pw)
+		_, err := io.Copy(zw, plainReader)
+		if err == nil {
+			err = zw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr
+}
+
+// gunzipWriter decompresses everything written to it into the wrapped
+// writer.
+type gunzipWriter struct {
+	pw   *io.PipeWriter
+	done chan error
+}
+
+func newGunzipWriter(plainWriter io.Writer) *gunzipWriter {
+	pr, pw := io.Pipe()
+	dw := &gunzipWriter{pw: pw, done: make(chan error, 1)}
+	go func() {
+		zr, err := gzip.NewReader(pr)
+		if err == nil {
+			_, err = io.Copy(plainWriter, zr)
+		}
+		if err != nil {
+			err = fmt.Errorf("failed to decompress: %w", err)
+		}
+		pr.CloseWithError(err)
+		dw.done <- err
+	}()
+	return dw
+}
+
+func (dw *gunzipWriter) Write(p []byte) (int, error) {
+	return dw.pw.Write(p)
+}
+
+// Close flushes the remaining data and reports decompression errors.
+func (dw *gunzipWriter) Close() error {
+	dw.pw.Close()
+	return <-dw.done
+}
+
+// Abort stops the decompression after a failure upstream.
+func (dw *gunzipWriter) Abort(err error) {
+	dw.pw.CloseWithError(err)
+	<-dw.done
+}
@@ -0,0 +1,114 @@
+package crypto
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChachaSealWithCompression(t *testing.T) {
+	req := require.New(t)
+
+	k, err := NewKey()
+	req.NoError(err, "key creation should succeed")
+
+	infile := []byte(strings.Repeat("id,name,email\n1,Jane Doe,jane@example.com\n", 200000))
+	for _, compression := range []Compression{CompressionNone, CompressionGzip} {
+		cipher, err := k.ChachaSealWithOptions(infile, SealOptions{Compression: compression})
+		req.NoError(err, "chacha seal should succeed")
+		if compression == CompressionGzip {
+			req.Less(len(cipher), len(infile)/10, "compressed cipher text should be smaller")
+		}
+
+		plain, err := k.ChachaOpen(cipher)
+		req.NoError(err, "chacha open should succeed")
+		req.True(bytes.Equal(infile, plain), "crypt-decrypt cycle failed")
+	}
+}
+
+func TestStreamHeaderIsAuthenticated(t *testing.T) {
+	req := require.New(t)
+
+	k, err := NewKey()
+	req.NoError(err, "key creation should succeed")
+
+	cipher, err := k.ChachaSealWithOptions([]byte("Hello World"), SealOptions{Compression: CompressionGzip})
+	req.NoError(err, "chacha seal should succeed")
+
+	cipher[len(streamMagic)+1] = byte(CompressionNone)
+	_, err = k.ChachaOpen(cipher)
+	req.ErrorIs(err, ErrAuthFailed)
+
+	cipher[len(streamMagic)] = 99
+	_, err = k.ChachaOpen(cipher)
+	req.ErrorIs(err, ErrUnknownFormat)
+
+	_, err = k.ChachaSealWithOptions([]byte("Hello World"), SealOptions{Compression: 42})
+	req.ErrorIs(err, ErrUnknownFormat)
+}
+
+func TestStreamTrailer(t *testing.T) {
+	req := require.New(t)
+
+	k, err := NewKey()
+	req.NoError(err, "key creation should succeed")
+
+	infile := bytes.Repeat([]byte("0123456789abcdef"), (2*chunkSize+100)/16)
+	for _, compression := range []Compression{CompressionNone, CompressionGzip} {
+		var cipher bytes.Buffer
+		sealed, err := k.ChachaSealFromReaderWithOptions(context.Background(), bytes.NewReader(infile), &cipher, SealOptions{Compression: compression})
+		req.NoError(err, "chacha seal should succeed")
+		req.Equal(int64(cipher.Len()), sealed.CipherBytes)
+		req.Equal(int64(len(infile)), sealed.PlainBytes)
+		req.Equal(sha256.Sum256(infile), sealed.PlainSHA256)
+
+		var plain bytes.Buffer
+		opened, err := k.ChachaOpenFromReaderWithOptions(context.Background(), bytes.NewReader(cipher.Bytes()), &plain, OpenOptions{})
+		req.NoError(err, "chacha open should succeed")
+		req.True(opened.Verified)
+		req.Equal(sealed.CipherBytes, opened.CipherBytes)
+		req.Equal(sealed.PlainBytes, opened.PlainBytes)
+		req.Equal(sealed.PlainSHA256, opened.PlainSHA256)
+		req.True(bytes.Equal(infile, plain.Bytes()))
+	}
+
+	// legacy streams are summarized, but not verified
+	cipher, err := k.ChachaSeal(infile)
+	req.NoError(err, "chacha seal should succeed")
+	opened, err := k.ChachaOpenFromReaderWithOptions(context.Background(), bytes.NewReader(cipher), io.Discard, OpenOptions{})
+	req.NoError(err, "chacha open should succeed")
+	req.False(opened.Verified)
+	req.Equal(sha256.Sum256(infile), opened.PlainSHA256)
+}
+
+func TestStreamTrailerDetectsTruncation(t *testing.T) {
+	req := require.New(t)
+
+	k, err := NewKey()
+	req.NoError(err, "key creation should succeed")
+
+	infile := bytes.Repeat([]byte{42}, chunkSize+100)
+	cipher, err := k.ChachaSealWithOptions(infile, SealOptions{})
+	req.NoError(err, "chacha seal should succeed")
+
+	// layout: header | chunk 1 | chunk 2 | trailer | zero
+	chunk1 := 8 + nonceSize + chunkSize + 16
+	chunk2 := 8 + nonceSize + 100 + 16
+	trailer := 8 + nonceSize + trailerSize + 16
+	req.Len(cipher, streamHeaderSize+chunk1+chunk2+trailer+8)
+
+	// drop the trailer
+	dropped := append(append([]byte{}, cipher[:streamHeaderSize+chunk1+chunk2]...), make([]byte, 8)...)
+	_, err = k.ChachaOpen(dropped)
+	req.ErrorIs(err, ErrTruncated)
+
+	// drop the last data chunk
+	dropped = append(append([]byte{}, cipher[:streamHeaderSize+chunk1]...), cipher[streamHeaderSize+chunk1+chunk2:]...)
+	_, err = k.ChachaOpen(dropped)
+	req.ErrorIs(err, ErrAuthFailed)
+}